@@ -38,13 +38,19 @@ replace (
 )
 
 require (
+	github.com/golang/protobuf v1.3.2
 	github.com/rancher/rio v0.6.0
 	github.com/rancher/wrangler v0.2.1-0.20191109002915-2a833f7e410d
 	github.com/rancher/wrangler-api v0.2.1-0.20191025043713-b1ca9c21825a
 	github.com/sirupsen/logrus v1.4.2
 	github.com/urfave/cli v1.22.1
 	golang.org/x/net v0.0.0-20190827160401-ba9fcec4b297
+	golang.org/x/sync v0.0.0-20190423024810-112230192c58
+	google.golang.org/grpc v1.24.0
 	k8s.io/api v0.0.0
+	k8s.io/apiextensions-apiserver v0.0.0
 	k8s.io/apimachinery v0.0.0
 	k8s.io/client-go v11.0.1-0.20190409021438-1a26190bd76a+incompatible
+	k8s.io/code-generator v0.0.0
+	k8s.io/gengo v0.0.0-20190822140433-26a664648505
 )
@@ -5,13 +5,17 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/rancher/rio-autoscaler/pkg/controllers"
 	"github.com/rancher/rio-autoscaler/pkg/controllers/servicescale"
 	"github.com/rancher/rio-autoscaler/pkg/gatewayserver"
+	"github.com/rancher/rio-autoscaler/pkg/metricsource"
+	"github.com/rancher/rio-autoscaler/pkg/shard"
 	"github.com/rancher/rio-autoscaler/types"
 	"github.com/rancher/wrangler/pkg/leader"
 	"github.com/rancher/wrangler/pkg/signals"
@@ -27,6 +31,10 @@ var (
 	VERSION = "v0.0.0-dev"
 )
 
+// shardReleaseTimeout bounds how long a stopping replica waits for its shards to be released, within the default
+// termination grace period of pods
+const shardReleaseTimeout = 20 * time.Second
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "rio-autoscaler"
@@ -42,6 +50,118 @@ func main() {
 			Usage: "Address to server on",
 			Value: ":80",
 		},
+		cli.StringFlag{
+			Name:  "stats-addr",
+			Usage: "Address replicas running autoscalers accept the request statistics of the gateways of other replicas on",
+			Value: ":8090",
+		},
+		cli.DurationFlag{
+			Name:  "stats-interval",
+			Usage: "How often the gateways of other replicas forward their request statistics to the replicas running autoscalers",
+			Value: 2 * time.Second,
+		},
+		cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "Certificate file the gateway serves TLS with, plain HTTP is served if not set",
+		},
+		cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "Key file of the gateway certificate",
+		},
+		cli.StringFlag{
+			Name:  "tls-client-ca",
+			Usage: "CA file client certificates are verified against, client certificates are required if set",
+		},
+		cli.DurationFlag{
+			Name:  "tls-reload-interval",
+			Usage: "How often the certificate files are checked for rotated certificates, 0 disables reloading",
+			Value: time.Minute,
+		},
+		cli.StringFlag{
+			Name:  "backend-ca",
+			Usage: "CA file the certificates of https backends are verified against, the system roots if not set",
+		},
+		cli.DurationFlag{
+			Name:        "stable-window",
+			Usage:       "Window over which metrics are averaged for scaling decisions",
+			Value:       servicescale.StableWindow,
+			Destination: &servicescale.StableWindow,
+		},
+		cli.DurationFlag{
+			Name:        "panic-window",
+			Usage:       "Window over which metrics are averaged to detect traffic bursts",
+			Value:       servicescale.PanicWindow,
+			Destination: &servicescale.PanicWindow,
+		},
+		cli.Float64Flag{
+			Name:        "panic-threshold",
+			Usage:       "Ratio of panic window desired scale to ready pods that puts the autoscaler in panic mode",
+			Value:       servicescale.PanicThreshold,
+			Destination: &servicescale.PanicThreshold,
+		},
+		cli.DurationFlag{
+			Name:  "activation-timeout",
+			Usage: "How long the gateway holds requests for a service that is scaling up from zero",
+			Value: time.Minute,
+		},
+		cli.IntFlag{
+			Name:  "activation-scale",
+			Usage: "Replicas the gateway scales a service to at least when it receives a request for it",
+			Value: 1,
+		},
+		cli.IntFlag{
+			Name:  "max-service-requests",
+			Usage: "Maximum requests the gateway holds per service, 0 is unlimited",
+			Value: 1000,
+		},
+		cli.IntFlag{
+			Name:  "max-requests",
+			Usage: "Maximum requests the gateway holds in total, 0 is unlimited",
+			Value: 10000,
+		},
+		cli.IntFlag{
+			Name:  "max-service-queue",
+			Usage: "Maximum requests per service waiting for the service to become ready, 0 is unlimited",
+			Value: 500,
+		},
+		cli.DurationFlag{
+			Name:  "retry-after",
+			Usage: "Retry-After sent to clients whose requests are rejected by the gateway",
+			Value: 5 * time.Second,
+		},
+		cli.DurationFlag{
+			Name:        "startup-timeout",
+			Usage:       "How long a pod that is not ready yet counts as capacity coming online",
+			Value:       servicescale.StartupTimeout,
+			Destination: &servicescale.StartupTimeout,
+		},
+		cli.DurationFlag{
+			Name:        "checkpoint-interval",
+			Usage:       "How often autoscaler state is saved to ConfigMaps so a new leader can restore it, 0 disables it",
+			Value:       servicescale.CheckpointInterval,
+			Destination: &servicescale.CheckpointInterval,
+		},
+		cli.DurationFlag{
+			Name:        "scrape-timeout",
+			Usage:       "Timeout of scraping the metrics of one pod",
+			Value:       metricsource.ScrapeTimeout,
+			Destination: &metricsource.ScrapeTimeout,
+		},
+		cli.IntFlag{
+			Name:        "scrape-concurrency",
+			Usage:       "Maximum number of pods of one service scraped at the same time",
+			Value:       metricsource.ScrapeConcurrency,
+			Destination: &metricsource.ScrapeConcurrency,
+		},
+		cli.IntFlag{
+			Name:  "shards",
+			Usage: "Number of shards services are split into across replicas, 0 runs every autoscaler on the leader",
+		},
+		cli.StringFlag{
+			Name:        "prometheus-url",
+			Usage:       "Prometheus server queried by services using the prometheus metric source",
+			Destination: &servicescale.PrometheusURL,
+		},
 		cli.BoolFlag{
 			Name: "debug",
 		},
@@ -69,31 +189,127 @@ func run(c *cli.Context) error {
 		return err
 	}
 
+	if err := types.Types(ctx, restConfig); err != nil {
+		return err
+	}
+
 	lock := &sync.RWMutex{}
 	autoscalers := map[string]*servicescale.SimpleScale{}
+	requests := metricsource.NewGatewayRequests()
 
 	ctx, rioContext := types.BuildContext(ctx, namespace, restConfig)
+	gatewayHandler, err := gatewayserver.NewHandler(ctx, rioContext, lock, autoscalers, requests, gatewayserver.Options{
+		ActivationTimeout:  c.Duration("activation-timeout"),
+		ActivationScale:    c.Int("activation-scale"),
+		MaxServiceRequests: c.Int("max-service-requests"),
+		MaxRequests:        c.Int("max-requests"),
+		MaxServiceQueue:    c.Int("max-service-queue"),
+		RetryAfter:         c.Duration("retry-after"),
+		BackendCAFile:      c.String("backend-ca"),
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		manager *shard.Manager
+		owners  gatewayserver.Owners
+	)
+	if shards := c.Int("shards"); shards > 0 {
+		manager, err = shard.NewManager(rioContext.K8s, namespace, "rio-autoscaler", shards)
+		if err != nil {
+			return err
+		}
+		if err := controllers.Register(ctx, rioContext, lock, autoscalers, requests, manager); err != nil {
+			return err
+		}
+		owners = manager
+	} else {
+		owners, err = gatewayserver.NewLeaderOwners(rioContext.K8s, namespace, "rio-autoscaler", c.Duration("stats-interval"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := rioContext.Start(ctx); err != nil {
+		return err
+	}
+
+	forwarder, err := gatewayserver.NewStatsForwarder(rioContext.K8s, namespace, owners, c.String("stats-addr"), c.Duration("stats-interval"), requests)
+	if err != nil {
+		return err
+	}
+	go forwarder.Run(ctx)
+
+	statsHandler, err := gatewayserver.StatsHandler(rioContext.K8s, namespace, requests, 3*c.Duration("stats-interval"))
+	if err != nil {
+		return err
+	}
+	statsSrv := &http.Server{
+		Addr:    c.String("stats-addr"),
+		Handler: statsHandler,
+	}
 	go func() {
-		leader.RunOrDie(ctx, namespace, "rio-autoscaler", rioContext.K8s, func(ctx context.Context) {
-			runtime.Must(controllers.Register(ctx, rioContext, lock, autoscalers))
-			runtime.Must(rioContext.Start(ctx))
-			<-ctx.Done()
-		})
+		logrus.Infof("starting gateway stats server on %s", statsSrv.Addr)
+		if err := statsSrv.ListenAndServe(); err != nil {
+			logrus.Errorf("Error running stats server: %v", err)
+		}
 	}()
 
-	gatewayHandler := gatewayserver.NewHandler(rioContext, lock, autoscalers)
+	if manager != nil {
+		go manager.Run(ctx)
+	} else {
+		go func() {
+			leader.RunOrDie(ctx, namespace, "rio-autoscaler", rioContext.K8s, func(ctx context.Context) {
+				runtime.Must(controllers.Register(ctx, rioContext, lock, autoscalers, requests, nil))
+				runtime.Must(rioContext.Start(ctx))
+				<-ctx.Done()
+			})
+		}()
+	}
+
 	srv := &http.Server{
 		Addr:    c.String("srv-addr"),
 		Handler: h2c.NewHandler(gatewayHandler, &http2.Server{}),
 	}
+	if c.String("tls-cert") != "" || c.String("tls-key") != "" {
+		srv.TLSConfig, err = gatewayserver.NewTLSConfig(ctx, gatewayserver.TLSOptions{
+			CertFile:       c.String("tls-cert"),
+			KeyFile:        c.String("tls-key"),
+			ClientCAFile:   c.String("tls-client-ca"),
+			ReloadInterval: c.Duration("tls-reload-interval"),
+		})
+		if err != nil {
+			return err
+		}
+		if err := http2.ConfigureServer(srv, &http2.Server{}); err != nil {
+			return err
+		}
+	} else if c.String("tls-client-ca") != "" {
+		return fmt.Errorf("--tls-client-ca requires --tls-cert and --tls-key")
+	}
 
 	go func() {
 		logrus.Infof("starting gateway server on %s", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil {
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			logrus.Errorf("Error running HTTP server: %v", err)
 		}
 	}()
 
 	<-ctx.Done()
+	if manager != nil {
+		// the state of the autoscalers is saved as their shards are released, which has to finish before exiting
+		select {
+		case <-manager.Done():
+		case <-time.After(shardReleaseTimeout):
+			logrus.Warnf("Timed out releasing autoscaler shards after %v", shardReleaseTimeout)
+		}
+	}
 	return srv.Shutdown(ctx)
 }
@@ -5,9 +5,10 @@ import (
 	"sync"
 
 	"github.com/rancher/rio-autoscaler/pkg/controllers/servicescale"
+	"github.com/rancher/rio-autoscaler/pkg/metricsource"
 	"github.com/rancher/rio-autoscaler/types"
 )
 
-func Register(ctx context.Context, rContext *types.Context, lock *sync.RWMutex, autoscalers map[string]*servicescale.SimpleScale) error {
-	return servicescale.Register(ctx, rContext, lock, autoscalers)
+func Register(ctx context.Context, rContext *types.Context, lock *sync.RWMutex, autoscalers map[string]*servicescale.SimpleScale, requests *metricsource.GatewayRequests, sharder servicescale.Sharder) error {
+	return servicescale.Register(ctx, rContext, lock, autoscalers, requests, sharder)
 }
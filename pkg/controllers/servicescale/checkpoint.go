@@ -0,0 +1,275 @@
+package servicescale
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rancher/rio-autoscaler/pkg/prometheus"
+	autoscalev1 "github.com/rancher/rio-autoscaler/types/apis/autoscale.rio.cattle.io/v1"
+	name2 "github.com/rancher/wrangler/pkg/name"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	checkpointKey   = "state"
+	checkpointLabel = "autoscale.rio.cattle.io/service"
+)
+
+// CheckpointInterval is how often the state of each SimpleScale is saved, 0 disables checkpoints
+var CheckpointInterval = time.Minute
+
+// checkpoint is the state of a SimpleScale saved to a ConfigMap, so a new leader continues scaling where the previous
+// one stopped instead of starting from an empty window
+type checkpoint struct {
+	Time             time.Time          `json:"time"`
+	Stats            []checkpointMetric `json:"stats,omitempty"`
+	LastActivation   time.Time          `json:"lastActivation"`
+	ActivationScale  int32              `json:"activationScale,omitempty"`
+	LastUpdatedScale int                `json:"lastUpdatedScale"`
+	PanicTime        time.Time          `json:"panicTime"`
+	MaxPanicScale    int32              `json:"maxPanicScale,omitempty"`
+	ScaleDownTime    time.Time          `json:"scaleDownTime"`
+}
+
+type checkpointMetric struct {
+	Time              time.Time                    `json:"time"`
+	ActiveRequest     int                          `json:"activeRequest,omitempty"`
+	ReadyPods         int                          `json:"readyPods,omitempty"`
+	RequestRate       float64                      `json:"requestRate,omitempty"`
+	RequestCounts     map[string]float64           `json:"requestCounts,omitempty"`
+	LatencyBuckets    map[string]checkpointBuckets `json:"latencyBuckets,omitempty"`
+	LatencyDeltas     checkpointBuckets            `json:"latencyDeltas,omitempty"`
+	CPUUtilization    float64                      `json:"cpuUtilization,omitempty"`
+	MemoryUtilization float64                      `json:"memoryUtilization,omitempty"`
+	Connections       float64                      `json:"connections,omitempty"`
+	ConnectionPods    int                          `json:"connectionPods,omitempty"`
+	ScrapeFailures    int                          `json:"scrapeFailures,omitempty"`
+	PendingPods       int                          `json:"pendingPods,omitempty"`
+}
+
+// checkpointBuckets are prometheus.Buckets keyed by their formatted upper bounds, which JSON requires
+type checkpointBuckets map[string]float64
+
+func checkpointName(serviceName string) string {
+	return name2.SafeConcatName(serviceName, "autoscale-state")
+}
+
+// saveCheckpoint writes the state of s to its ConfigMap, owned by the ServiceScaleRecommendation of the service so it is
+// removed along with it. Only the metrics within the stable window are saved, and the per pod counters only of the
+// newest one. A ConfigMap of the same name that is not the checkpoint of the service is left alone
+func (s *SimpleScale) saveCheckpoint(now time.Time) error {
+	ssr, err := s.ssrs.Cache().Get(s.namespace, s.serviceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	state := checkpoint{
+		Time:             now,
+		LastUpdatedScale: s.lastUpdatedScale,
+		PanicTime:        s.panicTime,
+		MaxPanicScale:    s.maxPanicScale,
+		ScaleDownTime:    s.scaleDownTime,
+	}
+	s.metrics.lock.RLock()
+	state.LastActivation = s.metrics.lastActivation
+	state.ActivationScale = s.metrics.activationScale
+	for i, m := range s.metrics.stats {
+		if m.time.Before(now.Add(-s.policy.StableWindow)) {
+			continue
+		}
+		saved := checkpointMetric{
+			Time:              m.time,
+			ActiveRequest:     m.activeRequest,
+			ReadyPods:         m.readyPods,
+			RequestRate:       m.requestRate,
+			LatencyDeltas:     encodeBuckets(m.latencyDeltas),
+			CPUUtilization:    m.cpuUtilization,
+			MemoryUtilization: m.memoryUtilization,
+			Connections:       m.connections,
+			ConnectionPods:    m.connectionPods,
+			ScrapeFailures:    m.scrapeFailures,
+			PendingPods:       m.pendingPods,
+		}
+		// the counters of each pod are only compared against the next metric, older metrics keep their rate and deltas
+		if i == len(s.metrics.stats)-1 {
+			saved.RequestCounts = m.requestCounts
+			saved.LatencyBuckets = encodePodBuckets(m.latencyBuckets)
+		}
+		state.Stats = append(state.Stats, saved)
+	}
+	s.metrics.lock.RUnlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	name := checkpointName(s.serviceName)
+	existing, err := s.configMaps.Get(s.namespace, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = s.configMaps.Create(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: s.namespace,
+				Labels: map[string]string{
+					checkpointLabel: s.serviceName,
+				},
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: autoscalev1.SchemeGroupVersion.String(),
+						Kind:       "ServiceScaleRecommendation",
+						Name:       ssr.Name,
+						UID:        ssr.UID,
+					},
+				},
+			},
+			Data: map[string]string{
+				checkpointKey: string(data),
+			},
+		})
+		return err
+	} else if err != nil {
+		return err
+	}
+	if err := checkpointOf(existing, ssr); err != nil {
+		return err
+	}
+
+	existing = existing.DeepCopy()
+	if existing.Data == nil {
+		existing.Data = map[string]string{}
+	}
+	existing.Data[checkpointKey] = string(data)
+	_, err = s.configMaps.Update(existing)
+	return err
+}
+
+// restoreCheckpoint loads the state saved by a previous leader into s. Metrics older than the retention of s are dropped,
+// and so is panic state of a checkpoint older than the stable window. The last traffic is not restored, traffic seen
+// since the checkpoint is unknown so the idle period starts over
+func (s *SimpleScale) restoreCheckpoint() error {
+	ssr, err := s.ssrs.Cache().Get(s.namespace, s.serviceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	cm, err := s.configMaps.Get(s.namespace, checkpointName(s.serviceName), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := checkpointOf(cm, ssr); err != nil {
+		return err
+	}
+
+	var state checkpoint
+	if err := json.Unmarshal([]byte(cm.Data[checkpointKey]), &state); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.lastUpdatedScale = state.LastUpdatedScale
+	s.scaleDownTime = state.ScaleDownTime
+	if now.Sub(state.Time) <= s.policy.StableWindow {
+		s.panicTime = state.PanicTime
+		s.maxPanicScale = state.MaxPanicScale
+	}
+
+	s.metrics.lock.Lock()
+	defer s.metrics.lock.Unlock()
+	s.metrics.lastActivation = state.LastActivation
+	s.metrics.activationScale = state.ActivationScale
+	for _, m := range state.Stats {
+		if now.Sub(m.Time) > s.metrics.retention {
+			continue
+		}
+		s.metrics.stats = append(s.metrics.stats, metric{
+			time:              m.Time,
+			activeRequest:     m.ActiveRequest,
+			readyPods:         m.ReadyPods,
+			requestRate:       m.RequestRate,
+			requestCounts:     m.RequestCounts,
+			latencyBuckets:    decodePodBuckets(m.LatencyBuckets),
+			latencyDeltas:     decodeBuckets(m.LatencyDeltas),
+			cpuUtilization:    m.CPUUtilization,
+			memoryUtilization: m.MemoryUtilization,
+			connections:       m.Connections,
+			connectionPods:    m.ConnectionPods,
+			scrapeFailures:    m.ScrapeFailures,
+			pendingPods:       m.PendingPods,
+		})
+	}
+
+	logrus.Infof("restored autoscaler state of %s/%s from %v, %v metrics, last scale %v", s.namespace, s.serviceName, state.Time, len(s.metrics.stats), s.lastUpdatedScale)
+	return nil
+}
+
+// checkpointOf returns an error unless cm is labeled as the checkpoint of the service of ssr and owned by ssr, so a
+// ConfigMap created by someone else, or left over from a deleted service of the same name, is never used
+func checkpointOf(cm *corev1.ConfigMap, ssr *autoscalev1.ServiceScaleRecommendation) error {
+	if cm.Labels[checkpointLabel] != ssr.Name {
+		return fmt.Errorf("configmap %s/%s is not labeled %s=%s", cm.Namespace, cm.Name, checkpointLabel, ssr.Name)
+	}
+	for _, owner := range cm.OwnerReferences {
+		if owner.UID == ssr.UID {
+			return nil
+		}
+	}
+	return fmt.Errorf("configmap %s/%s is not owned by ServiceScaleRecommendation %s/%s", cm.Namespace, cm.Name, ssr.Namespace, ssr.Name)
+}
+
+func encodeBuckets(buckets prometheus.Buckets) checkpointBuckets {
+	if buckets == nil {
+		return nil
+	}
+	result := checkpointBuckets{}
+	for le, count := range buckets {
+		result[strconv.FormatFloat(le, 'g', -1, 64)] = count
+	}
+	return result
+}
+
+func decodeBuckets(buckets checkpointBuckets) prometheus.Buckets {
+	if buckets == nil {
+		return nil
+	}
+	result := prometheus.Buckets{}
+	for le, count := range buckets {
+		if f, err := strconv.ParseFloat(le, 64); err == nil {
+			result[f] = count
+		}
+	}
+	return result
+}
+
+func encodePodBuckets(buckets map[string]prometheus.Buckets) map[string]checkpointBuckets {
+	if buckets == nil {
+		return nil
+	}
+	result := map[string]checkpointBuckets{}
+	for pod, b := range buckets {
+		result[pod] = encodeBuckets(b)
+	}
+	return result
+}
+
+func decodePodBuckets(buckets map[string]checkpointBuckets) map[string]prometheus.Buckets {
+	if buckets == nil {
+		return nil
+	}
+	result := map[string]prometheus.Buckets{}
+	for pod, b := range buckets {
+		result[pod] = decodeBuckets(b)
+	}
+	return result
+}
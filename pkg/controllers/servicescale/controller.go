@@ -4,12 +4,46 @@ import (
 	"context"
 	"sync"
 
+	"github.com/rancher/rio-autoscaler/pkg/metricsource"
 	"github.com/rancher/rio-autoscaler/types"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
-func Register(ctx context.Context, rContext *types.Context, lock *sync.RWMutex, autoscalers map[string]*SimpleScale) error {
-	handler := NewHandler(ctx, rContext.Rio.Rio().V1().Service(), rContext.Core.Core().V1().Pod().Cache(), autoscalers, lock)
+func Register(ctx context.Context, rContext *types.Context, lock *sync.RWMutex, autoscalers map[string]*SimpleScale, requests *metricsource.GatewayRequests, sharder Sharder) error {
+	ssrs := rContext.Autoscale.Autoscale().V1().ServiceScaleRecommendation()
+	apply := rContext.Apply.WithSetID("ssr-controller").WithCacheTypes(ssrs).WithSetOwnerReference(true, false)
 
-	rContext.Rio.Rio().V1().Service().OnChange(ctx, "ssr-controller", handler.OnChange)
+	resources := metricsource.NewResourceMetrics(rContext.K8s.Discovery().RESTClient())
+
+	handler := NewHandler(ctx, rContext.Rio.Rio().V1().Service(), ssrs, rContext.Core.Core().V1().Pod().Cache(), rContext.Core.Core().V1().ConfigMap(), apply, resources, requests, sharder, autoscalers, lock)
+
+	services := rContext.Rio.Rio().V1().Service()
+	services.OnChange(ctx, "ssr-controller", handler.OnChange)
+	if sharder != nil {
+		// services are reconciled again when shards move, so autoscalers follow their shards
+		sharder.OnChange(func() {
+			svcs, err := services.Cache().List("", labels.Everything())
+			if err != nil {
+				logrus.Errorf("Failed to list services after shards changed: %v", err)
+				return
+			}
+			for _, svc := range svcs {
+				services.Enqueue(svc.Namespace, svc.Name)
+			}
+		})
+		sharder.OnRelease(handler.handOffReleased)
+	}
 	return nil
 }
+
+// Sharder decides which services this replica autoscales when services are split across replicas
+type Sharder interface {
+	// Owns returns true if this replica autoscales the service key
+	Owns(key string) bool
+	// OnChange registers f to be called whenever the services owned by this replica change
+	OnChange(f func())
+	// OnRelease registers f to be called before services stop being owned by this replica, with a func returning true
+	// for their keys. Another replica does not take them over before f returns
+	OnRelease(f func(released func(key string) bool))
+}
@@ -3,11 +3,18 @@ package servicescale
 import (
 	"context"
 	"sync"
+	"time"
 
+	autoscalev1controller "github.com/rancher/rio-autoscaler/pkg/generated/controllers/autoscale.rio.cattle.io/v1"
+	"github.com/rancher/rio-autoscaler/pkg/metricsource"
+	autoscalev1 "github.com/rancher/rio-autoscaler/types/apis/autoscale.rio.cattle.io/v1"
 	riov1 "github.com/rancher/rio/pkg/apis/rio.cattle.io/v1"
 	riov1controller "github.com/rancher/rio/pkg/generated/controllers/rio.cattle.io/v1"
+	"github.com/rancher/rio/pkg/services"
 	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/apply"
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type SSRHandler struct {
@@ -16,18 +23,36 @@ type SSRHandler struct {
 	lock        *sync.RWMutex
 	pods        corev1controller.PodCache
 	services    riov1controller.ServiceController
+	ssrs        autoscalev1controller.ServiceScaleRecommendationController
+	configMaps  corev1controller.ConfigMapController
+	apply       apply.Apply
+	resources   *metricsource.ResourceMetrics
+	requests    *metricsource.GatewayRequests
+	sharder     Sharder
 }
 
 func NewHandler(ctx context.Context,
 	services riov1controller.ServiceController,
+	ssrs autoscalev1controller.ServiceScaleRecommendationController,
 	podClientCache corev1controller.PodCache,
+	configMaps corev1controller.ConfigMapController,
+	apply apply.Apply,
+	resources *metricsource.ResourceMetrics,
+	requests *metricsource.GatewayRequests,
+	sharder Sharder,
 	autoscalers map[string]*SimpleScale,
 	lock *sync.RWMutex) *SSRHandler {
 
 	return &SSRHandler{
 		ctx:         ctx,
 		services:    services,
+		ssrs:        ssrs,
 		pods:        podClientCache,
+		configMaps:  configMaps,
+		apply:       apply,
+		resources:   resources,
+		requests:    requests,
+		sharder:     sharder,
 		lock:        lock,
 		autoscalers: autoscalers,
 	}
@@ -35,31 +60,138 @@ func NewHandler(ctx context.Context,
 
 func (s *SSRHandler) OnChange(key string, svc *riov1.Service) (*riov1.Service, error) {
 	if svc == nil || svc.DeletionTimestamp != nil {
-		if ss, ok := s.autoscalers[key]; ok {
-			ss.Stop()
-			s.lock.Lock()
-			defer s.lock.Unlock()
-			logrus.Debugf("deleting autoscale key %v", key)
-			delete(s.autoscalers, key)
-		}
+		s.removeScale(key)
 		return nil, nil
 	}
 
+	if s.sharder != nil && !s.sharder.Owns(key) {
+		s.handOff(key)
+		return svc, nil
+	}
+
 	if !autoscaleEnabled(svc) {
-		return nil, nil
+		s.removeScale(key)
+		return svc, s.apply.WithOwner(svc).ApplyObjects()
+	}
+
+	if err := s.apply.WithOwner(svc).ApplyObjects(newServiceScaleRecommendation(svc)); err != nil {
+		return svc, err
+	}
+
+	policy, err := PolicyFromService(svc)
+	if err != nil {
+		return svc, err
 	}
 
-	if _, ok := s.autoscalers[key]; !ok {
-		ss := NewSimpleScale(svc, s.pods, s.services)
-		ss.Start()
-		s.lock.Lock()
-		defer s.lock.Unlock()
+	s.lock.RLock()
+	existing, ok := s.autoscalers[key]
+	s.lock.RUnlock()
+
+	app, version := services.AppAndVersion(svc)
+	switch {
+	case !ok:
 		logrus.Debugf("adding autoscaler key %v", key)
-		s.autoscalers[key] = &ss
+		ss, err := NewSimpleScale(svc, policy, s.pods, s.services, s.ssrs, s.configMaps, s.resources, s.requests)
+		if err != nil {
+			return svc, err
+		}
+		if err := ss.restoreCheckpoint(); err != nil {
+			logrus.Warnf("Failed to restore autoscaler state for %s, error: %v", key, err)
+		}
+		s.addScale(key, &ss)
+	case existing.app != app || existing.version != version:
+		logrus.Debugf("app or version changed, restarting autoscaler key %v", key)
+		s.removeScale(key)
+		ss, err := NewSimpleScale(svc, policy, s.pods, s.services, s.ssrs, s.configMaps, s.resources, s.requests)
+		if err != nil {
+			return svc, err
+		}
+		ss.inherit(existing)
+		s.addScale(key, &ss)
+	case existing.Policy() != policy:
+		logrus.Debugf("autoscale policy changed, rebuilding autoscaler key %v", key)
+		s.removeScale(key)
+		ss, err := NewSimpleScale(svc, policy, s.pods, s.services, s.ssrs, s.configMaps, s.resources, s.requests)
+		if err != nil {
+			return svc, err
+		}
+		ss.inherit(existing)
+		s.addScale(key, &ss)
 	}
 	return svc, nil
 }
 
+func (s *SSRHandler) addScale(key string, ss *SimpleScale) {
+	ss.Start()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.autoscalers[key] = ss
+}
+
+func (s *SSRHandler) removeScale(key string) {
+	s.lock.Lock()
+	ss, ok := s.autoscalers[key]
+	delete(s.autoscalers, key)
+	s.lock.Unlock()
+
+	if ok {
+		logrus.Debugf("deleting autoscale key %v", key)
+		ss.Stop()
+	}
+}
+
+// handOff stops the autoscaler of a service whose shard moved to another replica and saves its state for the new owner
+func (s *SSRHandler) handOff(key string) {
+	s.lock.Lock()
+	ss, ok := s.autoscalers[key]
+	delete(s.autoscalers, key)
+	s.lock.Unlock()
+
+	if !ok {
+		return
+	}
+	logrus.Debugf("handing off autoscale key %v", key)
+	ss.Stop()
+	if err := ss.saveCheckpoint(time.Now()); err != nil {
+		logrus.Warnf("Failed to save autoscaler state for %s, error: %v", key, err)
+	}
+}
+
+// handOffReleased hands off the autoscalers of the released services before another replica takes them over, so it
+// restores the state they have now
+func (s *SSRHandler) handOffReleased(released func(key string) bool) {
+	s.lock.RLock()
+	var keys []string
+	for key := range s.autoscalers {
+		if released(key) {
+			keys = append(keys, key)
+		}
+	}
+	s.lock.RUnlock()
+
+	for _, key := range keys {
+		s.handOff(key)
+	}
+}
+
 func autoscaleEnabled(service *riov1.Service) bool {
 	return service.Spec.Autoscale != nil && service.Spec.Autoscale.MinReplicas != nil && service.Spec.Autoscale.MaxReplicas != nil && *service.Spec.Autoscale.MinReplicas != *service.Spec.Autoscale.MaxReplicas
 }
+
+func newServiceScaleRecommendation(svc *riov1.Service) *autoscalev1.ServiceScaleRecommendation {
+	app, version := services.AppAndVersion(svc)
+	return autoscalev1.NewServiceScaleRecommendation(svc.Namespace, svc.Name, autoscalev1.ServiceScaleRecommendation{
+		Spec: autoscalev1.ServiceScaleRecommendationSpec{
+			ServiceName: svc.Name,
+			MinScale:    svc.Spec.Autoscale.MinReplicas,
+			MaxScale:    svc.Spec.Autoscale.MaxReplicas,
+			Concurrency: svc.Spec.Autoscale.Concurrency,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app":     app,
+					"version": version,
+				},
+			},
+		},
+	})
+}
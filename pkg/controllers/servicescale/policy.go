@@ -0,0 +1,275 @@
+package servicescale
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rancher/rio-autoscaler/pkg/metricsource"
+	riov1 "github.com/rancher/rio/pkg/apis/rio.cattle.io/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	ConcurrencyMode = "concurrency"
+	RPSMode         = "rps"
+	LatencyMode     = "latency"
+	ConnectionsMode = "connections"
+
+	annotationPrefix = "autoscale.rio.cattle.io/"
+
+	StableWindowAnnotation       = annotationPrefix + "stable-window"
+	PanicWindowAnnotation        = annotationPrefix + "panic-window"
+	PanicThresholdAnnotation     = annotationPrefix + "panic-threshold"
+	ScrapeIntervalAnnotation     = annotationPrefix + "scrape-interval"
+	DecisionIntervalAnnotation   = annotationPrefix + "decision-interval"
+	TargetUtilizationAnnotation  = annotationPrefix + "target-utilization"
+	ScaleDownDelayAnnotation     = annotationPrefix + "scale-down-delay"
+	ScaleDownThresholdAnnotation = annotationPrefix + "scale-down-threshold"
+	MaxScaleUpStepAnnotation     = annotationPrefix + "max-scale-up-step"
+	MaxScaleDownStepAnnotation   = annotationPrefix + "max-scale-down-step"
+	MetricSourceAnnotation       = annotationPrefix + "metric-source"
+	PrometheusQueryAnnotation    = annotationPrefix + "prometheus-query"
+	ModeAnnotation               = annotationPrefix + "mode"
+	TargetRPSAnnotation          = annotationPrefix + "target-rps"
+	TargetLatencyAnnotation      = annotationPrefix + "target-latency"
+	TargetConnectionsAnnotation  = annotationPrefix + "target-connections"
+	LatencyQuantileAnnotation    = annotationPrefix + "latency-quantile"
+	TargetCPUAnnotation          = annotationPrefix + "target-cpu-utilization"
+	TargetMemoryAnnotation       = annotationPrefix + "target-memory-utilization"
+	ScaleToZeroIdleAnnotation    = annotationPrefix + "scale-to-zero-idle-period"
+	ScaleToZeroGraceAnnotation   = annotationPrefix + "scale-to-zero-grace-period"
+)
+
+// Policy holds the tunables of a SimpleScale. Every field but PrometheusURL can be overridden per service with an autoscale.rio.cattle.io/* annotation
+type Policy struct {
+	// Mode is the signal scaling decisions are made on, concurrency, rps, latency or connections
+	Mode string
+
+	// TargetRPS is the requests per second each pod is targeted to serve in rps mode
+	TargetRPS float64
+
+	// TargetLatency is the latency the LatencyQuantile of responses should stay under in latency mode
+	TargetLatency   time.Duration
+	LatencyQuantile float64
+
+	// TargetConnections is the open upgraded connections such as WebSockets each pod is targeted to hold in
+	// connections mode
+	TargetConnections float64
+
+	// TargetCPUUtilization and TargetMemoryUtilization are the usage of pods as a fraction of their requests the
+	// scaler keeps pods at in addition to the mode, 0 means disabled
+	TargetCPUUtilization    float64
+	TargetMemoryUtilization float64
+
+	StableWindow     time.Duration
+	PanicWindow      time.Duration
+	PanicThreshold   float64
+	ScrapeInterval   time.Duration
+	DecisionInterval time.Duration
+
+	// TargetUtilization is the fraction of the target of the mode each pod is targeted to serve, it does not apply to
+	// the target latency
+	TargetUtilization float64
+
+	// ScaleDownDelay is how long the desired scale has to stay below the current scale before scaling down
+	ScaleDownDelay time.Duration
+
+	// ScaleDownThreshold is the minimal fraction of the current scale a scale down has to remove
+	ScaleDownThreshold float64
+
+	// ScaleToZeroIdlePeriod is how long a service with no minimum replicas has to see no traffic before it is scaled to
+	// zero, ScaleToZeroGracePeriod is how long after an activation by the gateway it is kept from scaling to zero
+	ScaleToZeroIdlePeriod  time.Duration
+	ScaleToZeroGracePeriod time.Duration
+
+	// MaxScaleUpStep and MaxScaleDownStep limit the replicas added or removed in one decision, 0 means unlimited
+	MaxScaleUpStep   int32
+	MaxScaleDownStep int32
+
+	// MetricSource is the name of the metricsource the service is scraped with
+	MetricSource string
+	// PrometheusURL is always the --prometheus-url flag, so services cannot make the autoscaler send requests to any
+	// other server
+	PrometheusURL   string
+	PrometheusQuery string
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Mode:                   ConcurrencyMode,
+		LatencyQuantile:        0.95,
+		StableWindow:           StableWindow,
+		PanicWindow:            PanicWindow,
+		PanicThreshold:         PanicThreshold,
+		ScrapeInterval:         tickerInterval,
+		DecisionInterval:       decisionInterval,
+		TargetUtilization:      1,
+		ScaleDownThreshold:     0.5,
+		ScaleToZeroIdlePeriod:  5 * time.Minute,
+		ScaleToZeroGracePeriod: 30 * time.Second,
+		MetricSource:           metricsource.Linkerd,
+		PrometheusURL:          PrometheusURL,
+	}
+}
+
+// PolicyFromService returns the default policy overridden by the annotations of svc
+func PolicyFromService(svc *riov1.Service) (Policy, error) {
+	p := DefaultPolicy()
+	annotations := svc.Annotations
+
+	durations := map[string]*time.Duration{
+		StableWindowAnnotation:     &p.StableWindow,
+		PanicWindowAnnotation:      &p.PanicWindow,
+		ScrapeIntervalAnnotation:   &p.ScrapeInterval,
+		DecisionIntervalAnnotation: &p.DecisionInterval,
+		ScaleDownDelayAnnotation:   &p.ScaleDownDelay,
+		TargetLatencyAnnotation:    &p.TargetLatency,
+		ScaleToZeroIdleAnnotation:  &p.ScaleToZeroIdlePeriod,
+		ScaleToZeroGraceAnnotation: &p.ScaleToZeroGracePeriod,
+	}
+	for key, field := range durations {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return p, fmt.Errorf("invalid annotation %s: %v", key, err)
+		}
+		*field = d
+	}
+
+	floats := map[string]*float64{
+		PanicThresholdAnnotation:     &p.PanicThreshold,
+		TargetUtilizationAnnotation:  &p.TargetUtilization,
+		TargetRPSAnnotation:          &p.TargetRPS,
+		TargetConnectionsAnnotation:  &p.TargetConnections,
+		LatencyQuantileAnnotation:    &p.LatencyQuantile,
+		TargetCPUAnnotation:          &p.TargetCPUUtilization,
+		TargetMemoryAnnotation:       &p.TargetMemoryUtilization,
+		ScaleDownThresholdAnnotation: &p.ScaleDownThreshold,
+	}
+	for key, field := range floats {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid annotation %s: %v", key, err)
+		}
+		*field = f
+	}
+
+	ints := map[string]*int32{
+		MaxScaleUpStepAnnotation:   &p.MaxScaleUpStep,
+		MaxScaleDownStepAnnotation: &p.MaxScaleDownStep,
+	}
+	for key, field := range ints {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		i, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return p, fmt.Errorf("invalid annotation %s: %v", key, err)
+		}
+		*field = int32(i)
+	}
+
+	strs := map[string]*string{
+		ModeAnnotation:            &p.Mode,
+		MetricSourceAnnotation:    &p.MetricSource,
+		PrometheusQueryAnnotation: &p.PrometheusQuery,
+	}
+	for key, field := range strs {
+		if value, ok := annotations[key]; ok {
+			*field = value
+		}
+	}
+
+	return p, p.Validate()
+}
+
+func (p Policy) Validate() error {
+	if p.StableWindow <= 0 || p.PanicWindow <= 0 || p.ScrapeInterval <= 0 || p.DecisionInterval <= 0 {
+		return fmt.Errorf("windows and intervals must be positive")
+	}
+	if p.PanicWindow > p.StableWindow {
+		return fmt.Errorf("panic window %v must not be longer than stable window %v", p.PanicWindow, p.StableWindow)
+	}
+	if p.ScrapeInterval > p.StableWindow {
+		return fmt.Errorf("scrape interval %v must not be longer than stable window %v", p.ScrapeInterval, p.StableWindow)
+	}
+	if p.PanicThreshold <= 1 {
+		return fmt.Errorf("panic threshold %v must be greater than 1", p.PanicThreshold)
+	}
+	if p.TargetUtilization <= 0 || p.TargetUtilization > 1 {
+		return fmt.Errorf("target utilization %v must be in (0, 1]", p.TargetUtilization)
+	}
+	if p.ScaleDownDelay < 0 {
+		return fmt.Errorf("scale down delay %v must not be negative", p.ScaleDownDelay)
+	}
+	if p.ScaleToZeroIdlePeriod < 0 || p.ScaleToZeroGracePeriod < 0 {
+		return fmt.Errorf("scale to zero idle and grace periods must not be negative")
+	}
+	if p.ScaleDownThreshold < 0 || p.ScaleDownThreshold > 1 {
+		return fmt.Errorf("scale down threshold %v must be in [0, 1]", p.ScaleDownThreshold)
+	}
+	if p.MaxScaleUpStep < 0 || p.MaxScaleDownStep < 0 {
+		return fmt.Errorf("max scale steps must not be negative")
+	}
+	if p.TargetCPUUtilization < 0 || p.TargetMemoryUtilization < 0 {
+		return fmt.Errorf("target cpu and memory utilization must not be negative")
+	}
+	switch p.Mode {
+	case ConcurrencyMode:
+	case RPSMode:
+		if p.TargetRPS <= 0 {
+			return fmt.Errorf("mode %s requires a positive %s", p.Mode, TargetRPSAnnotation)
+		}
+	case ConnectionsMode:
+		if p.TargetConnections <= 0 {
+			return fmt.Errorf("mode %s requires a positive %s", p.Mode, TargetConnectionsAnnotation)
+		}
+	case LatencyMode:
+		if p.TargetLatency <= 0 {
+			return fmt.Errorf("mode %s requires a positive %s", p.Mode, TargetLatencyAnnotation)
+		}
+		if p.LatencyQuantile <= 0 || p.LatencyQuantile >= 1 {
+			return fmt.Errorf("latency quantile %v must be in (0, 1)", p.LatencyQuantile)
+		}
+		if p.MetricSource != metricsource.Linkerd && p.MetricSource != metricsource.Envoy {
+			return fmt.Errorf("mode %s is not supported by metric source %s", p.Mode, p.MetricSource)
+		}
+	default:
+		return fmt.Errorf("unknown autoscale mode %s", p.Mode)
+	}
+	switch p.MetricSource {
+	case metricsource.Linkerd, metricsource.Envoy:
+	case metricsource.Prometheus:
+		if p.PrometheusURL == "" {
+			return fmt.Errorf("metric source %s requires --prometheus-url", p.MetricSource)
+		}
+	default:
+		return fmt.Errorf("unknown metric source %s", p.MetricSource)
+	}
+	return nil
+}
+
+func (p Policy) resourceScaling() bool {
+	return p.TargetCPUUtilization > 0 || p.TargetMemoryUtilization > 0
+}
+
+// resourceNames returns the resources the policy has utilization targets for
+func (p Policy) resourceNames() []corev1.ResourceName {
+	var names []corev1.ResourceName
+	if p.TargetCPUUtilization > 0 {
+		names = append(names, corev1.ResourceCPU)
+	}
+	if p.TargetMemoryUtilization > 0 {
+		names = append(names, corev1.ResourceMemory)
+	}
+	return names
+}
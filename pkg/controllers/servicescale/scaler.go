@@ -1,21 +1,20 @@
 package servicescale
 
 import (
-	"bufio"
-	"fmt"
 	"math"
-	"net/http"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 
+	autoscalev1controller "github.com/rancher/rio-autoscaler/pkg/generated/controllers/autoscale.rio.cattle.io/v1"
+	"github.com/rancher/rio-autoscaler/pkg/metricsource"
+	"github.com/rancher/rio-autoscaler/pkg/prometheus"
 	riov1 "github.com/rancher/rio/pkg/apis/rio.cattle.io/v1"
 	riov1controller "github.com/rancher/rio/pkg/generated/controllers/rio.cattle.io/v1"
 	services2 "github.com/rancher/rio/pkg/services"
 	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 )
@@ -27,12 +26,22 @@ type SimpleScale struct {
 	version     string
 	stop        chan struct{}
 	stopScaling chan struct{}
-	httpClient  *http.Client
+	source      metricsource.MetricSource
+	resources   *metricsource.ResourceMetrics
 	metrics     metrics
 	podLister   corev1controller.PodCache
 	services    riov1controller.ServiceController
+	ssrs        autoscalev1controller.ServiceScaleRecommendationController
+	configMaps  corev1controller.ConfigMapController
+	policy      Policy
 
 	lastUpdatedScale int
+	panicTime        time.Time
+	maxPanicScale    int32
+	scaleDownTime    time.Time
+	lastCheckpoint   time.Time
+	// observedScale is the desired scale of the ServiceScaleRecommendation at the last decision, -1 before the first
+	observedScale int32
 }
 
 const (
@@ -40,10 +49,42 @@ const (
 	houseKeepTicker  = time.Minute * 5
 	tickerInterval   = time.Second * 5
 	decisionInterval = time.Second * 15
+
+	// latencyScaleDownRatio is the fraction of the target latency the latency quantile has to stay under over a window
+	// before a replica is removed in latency mode
+	latencyScaleDownRatio = 0.5
+)
+
+var (
+	// StableWindow is the window over which metrics are averaged to make normal scaling decisions
+	StableWindow = time.Second * 60
+	// PanicWindow is the shorter window used to detect bursts of traffic
+	PanicWindow = time.Second * 10
+	// PanicThreshold is the ratio of panic window desired scale to ready and starting pods above which the scaler panics
+	PanicThreshold = 2.0
+	// PrometheusURL is the Prometheus server used by services with the prometheus metric source
+	PrometheusURL = ""
+	// StartupTimeout is how long a pod that is not ready yet counts as capacity coming online
+	StartupTimeout = time.Minute * 10
 )
 
-func NewSimpleScale(svc *riov1.Service, podCache corev1controller.PodCache, services riov1controller.ServiceController) SimpleScale {
+func NewSimpleScale(svc *riov1.Service, policy Policy, podCache corev1controller.PodCache, services riov1controller.ServiceController, ssrs autoscalev1controller.ServiceScaleRecommendationController, configMaps corev1controller.ConfigMapController, resources *metricsource.ResourceMetrics, requests *metricsource.GatewayRequests) (SimpleScale, error) {
 	app, version := services2.AppAndVersion(svc)
+	target := metricsource.Target{
+		Namespace: svc.Namespace,
+		Service:   svc.Name,
+		App:       app,
+		Version:   version,
+	}
+	source, err := metricsource.New(policy.MetricSource, target, metricsource.Options{
+		PrometheusURL:   policy.PrometheusURL,
+		PrometheusQuery: policy.PrometheusQuery,
+	})
+	if err != nil {
+		return SimpleScale{}, err
+	}
+	source = metricsource.WithGateway(source, requests, target)
+
 	return SimpleScale{
 		namespace:   svc.Namespace,
 		serviceName: svc.Name,
@@ -51,26 +92,84 @@ func NewSimpleScale(svc *riov1.Service, podCache corev1controller.PodCache, serv
 		version:     version,
 		stop:        make(chan struct{}),
 		stopScaling: make(chan struct{}),
-		httpClient:  http.DefaultClient,
+		source:      source,
+		resources:   resources,
 		metrics: metrics{
-			stop: make(chan struct{}),
-			lock: sync.RWMutex{},
+			stop:        make(chan struct{}),
+			lock:        sync.RWMutex{},
+			retention:   maxDuration(houseKeepTime, policy.StableWindow),
+			lastTraffic: time.Now(),
 		},
-		podLister: podCache,
-		services:  services,
-	}
+		podLister:     podCache,
+		services:      services,
+		ssrs:          ssrs,
+		configMaps:    configMaps,
+		policy:        policy,
+		observedScale: -1,
+	}, nil
 }
 
 type metrics struct {
-	stop  chan struct{}
-	lock  sync.RWMutex
-	stats []metric
+	stop      chan struct{}
+	lock      sync.RWMutex
+	stats     []metric
+	retention time.Duration
+
+	// lastTraffic is the last time requests were seen, lastActivation the last time the gateway activated the service
+	lastTraffic    time.Time
+	lastActivation time.Time
+	// activationScale is the scale the gateway raised the service to on its last activation
+	activationScale int32
+	// scrapeFailures counts the pods whose metrics could not be scraped and that are not reported on the
+	// ServiceScaleRecommendation yet
+	scrapeFailures int64
 }
 
 type metric struct {
 	time          time.Time
 	activeRequest int
 	readyPods     int
+	// requestRate is the average requests per second served by each ready pod since the previous metric
+	requestRate float64
+	// requestCounts are the cumulative request counters of each pod
+	requestCounts map[string]float64
+	// latencyBuckets are the cumulative latency histograms of each pod
+	latencyBuckets map[string]prometheus.Buckets
+	// latencyDeltas is the latency histogram of the requests served since the previous metric
+	latencyDeltas prometheus.Buckets
+	// cpuUtilization and memoryUtilization are the resource usage of ready pods as a fraction of their requests
+	cpuUtilization    float64
+	memoryUtilization float64
+	// connections is the average open upgraded connections per ready pod, connectionPods the pods holding any
+	connections    float64
+	connectionPods int
+	// scrapeFailures are the ready pods whose metrics could not be scraped
+	scrapeFailures int
+	// pendingPods are the pods that are starting and not ready yet
+	pendingPods int
+}
+
+// scrapedPods returns the ready pods whose metrics were scraped, which per pod values are averaged over. All ready pods
+// are counted if none was scraped, and one pod if there are none
+func (m metric) scrapedPods() int {
+	if scraped := m.readyPods - m.scrapeFailures; scraped > 0 {
+		return scraped
+	}
+	if m.readyPods > 0 {
+		return m.readyPods
+	}
+	return 1
+}
+
+// perPod returns the per pod value of m that is compared against the scaling target in the given mode
+func (m metric) perPod(mode string) float64 {
+	switch mode {
+	case RPSMode:
+		return m.requestRate
+	case ConnectionsMode:
+		return m.connections
+	}
+	return float64(m.activeRequest)
 }
 
 func (s *metrics) clean(offset int) {
@@ -89,6 +188,247 @@ func (s *metrics) read(index int) metric {
 func (s *metrics) append(m metric) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	s.stats = append(s.stats, m)
+}
+
+func (s *metrics) markTraffic(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastTraffic = now
+}
+
+// countScrapeFailures adds failures to the scrape failures that are not reported yet
+func (s *metrics) countScrapeFailures(failures int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.scrapeFailures += int64(failures)
+}
+
+// takeScrapeFailures returns the scrape failures that are not reported yet and resets them
+func (s *metrics) takeScrapeFailures() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	failures := s.scrapeFailures
+	s.scrapeFailures = 0
+	return failures
+}
+
+// activate records an activation to scale at now, the caller must hold the lock
+func (s *metrics) activate(now time.Time, scale int32) {
+	s.lastTraffic = now
+	s.lastActivation = now
+	s.activationScale = scale
+}
+
+// idle returns true if no traffic was seen for idlePeriod and the service was not activated within gracePeriod
+func (s *metrics) idle(now time.Time, idlePeriod, gracePeriod time.Duration) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return now.Sub(s.lastTraffic) >= idlePeriod && now.Sub(s.lastActivation) >= gracePeriod
+}
+
+// pendingPods returns the pods that were starting in the latest metric
+func (s *metrics) pendingPods() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if len(s.stats) == 0 {
+		return 0
+	}
+	return s.stats[len(s.stats)-1].pendingPods
+}
+
+// connectionPods returns the pods holding upgraded connections in the latest metric
+func (s *metrics) connectionPods() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if len(s.stats) == 0 {
+		return 0
+	}
+	return s.stats[len(s.stats)-1].connectionPods
+}
+
+// activationFloor returns the scale the gateway activated the service to if that was within gracePeriod, 0 otherwise
+func (s *metrics) activationFloor(now time.Time, gracePeriod time.Duration) int32 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if now.Sub(s.lastActivation) >= gracePeriod {
+		return 0
+	}
+	return s.activationScale
+}
+
+// desiredScale returns the scale needed for concurrency given the samples within window, along with the average ready pods
+func (s *metrics) desiredScale(now time.Time, window time.Duration, policy Policy, target float64) (int32, float64, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var total float64
+	var count, readyPodTotal int
+	latency := prometheus.Buckets{}
+	for i := len(s.stats) - 1; i >= 0; i-- {
+		if s.stats[i].time.Before(now.Add(-window)) {
+			break
+		}
+		total += s.stats[i].perPod(policy.Mode)
+		for le, c := range s.stats[i].latencyDeltas {
+			latency[le] += c
+		}
+		count++
+		readyPodTotal += s.stats[i].readyPods
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+
+	readyPods := float64(readyPodTotal) / float64(count)
+	currentReplica := readyPods
+	if currentReplica == 0 {
+		currentReplica = 1
+	}
+
+	var scale float64
+	switch {
+	case target == 0:
+		scale = currentReplica
+	case policy.Mode == LatencyMode:
+		scale = latencyScale(currentReplica, latency.Quantile(policy.LatencyQuantile), target)
+	default:
+		scale = currentReplica * (total / float64(count)) / target
+	}
+
+	desiredScale := int32(math.Ceil(scale))
+	logrus.Debugf("window %v average ready pods: %v, scale: %v, desired scale: %v", window, readyPods, scale, desiredScale)
+	return desiredScale, readyPods, true
+}
+
+// latencyScale returns the scale of currentReplica pods whose latency quantile is q given the target latency. Latency
+// does not fall in proportion to the replicas added, so only scaling up follows q/target. While q is under
+// latencyScaleDownRatio of the target one replica is removed, in between the scale is held
+func latencyScale(currentReplica, q, target float64) float64 {
+	switch {
+	case math.IsNaN(q):
+		// no requests in the window means there is no latency to keep under the target
+		return 0
+	case q > target:
+		return currentReplica * q / target
+	case q < target*latencyScaleDownRatio:
+		return currentReplica - 1
+	}
+	return currentReplica
+}
+
+// requestRate returns the average requests per second per scraped pod between the last metric and m.
+// A counter lower than its previous value means the pod restarted, so the whole counter is counted. Pods without a
+// previous counter are skipped because it is unknown when their requests were served
+func (s *metrics) requestRate(m metric) float64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.stats) == 0 || m.readyPods == 0 {
+		return 0
+	}
+	last := s.stats[len(s.stats)-1]
+	elapsed := m.time.Sub(last.time).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+
+	var requests float64
+	for pod, count := range m.requestCounts {
+		previous, ok := last.requestCounts[pod]
+		if !ok {
+			continue
+		}
+		if count < previous {
+			requests += count
+		} else {
+			requests += count - previous
+		}
+	}
+	return requests / elapsed / float64(m.scrapedPods())
+}
+
+// latencyDeltas returns the latency histogram of the requests served between the last metric and m, handling restarted
+// and new pods the same way as requestRate
+func (s *metrics) latencyDeltas(m metric) prometheus.Buckets {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	deltas := prometheus.Buckets{}
+	if len(s.stats) == 0 {
+		return deltas
+	}
+	last := s.stats[len(s.stats)-1]
+
+	for pod, buckets := range m.latencyBuckets {
+		previous, ok := last.latencyBuckets[pod]
+		if !ok {
+			continue
+		}
+		reset := false
+		for le, count := range buckets {
+			if count < previous[le] {
+				reset = true
+				break
+			}
+		}
+		for le, count := range buckets {
+			if reset {
+				deltas[le] += count
+			} else {
+				deltas[le] += count - previous[le]
+			}
+		}
+	}
+	return deltas
+}
+
+// resourceScale returns the scale needed to keep the cpu and memory utilization of the samples within window at the
+// targets of policy
+func (s *metrics) resourceScale(now time.Time, window time.Duration, policy Policy) int32 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var cpu, memory float64
+	var count, readyPodTotal int
+	for i := len(s.stats) - 1; i >= 0; i-- {
+		if s.stats[i].time.Before(now.Add(-window)) {
+			break
+		}
+		cpu += s.stats[i].cpuUtilization
+		memory += s.stats[i].memoryUtilization
+		readyPodTotal += s.stats[i].readyPods
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+
+	readyPods := float64(readyPodTotal) / float64(count)
+	var desiredScale int32
+	if policy.TargetCPUUtilization > 0 {
+		desiredScale = int32(math.Ceil(readyPods * (cpu / float64(count)) / policy.TargetCPUUtilization))
+	}
+	if policy.TargetMemoryUtilization > 0 {
+		if d := int32(math.Ceil(readyPods * (memory / float64(count)) / policy.TargetMemoryUtilization)); d > desiredScale {
+			desiredScale = d
+		}
+	}
+	logrus.Debugf("window %v average cpu utilization: %v, average memory utilization: %v, desired scale: %v", window, cpu/float64(count), memory/float64(count), desiredScale)
+	return desiredScale
+}
+
+// expired returns how many of the oldest stats are past the retention at now, which are all of them if none is fresh.
+// Only houseKeeping removes stats, so the count stays valid while the scrape goroutine appends
+func (s *metrics) expired(now time.Time) int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for i, stat := range s.stats {
+		if now.Before(stat.time.Add(s.retention)) {
+			return i
+		}
+	}
+	return len(s.stats)
 }
 
 func (s *metrics) houseKeeping() {
@@ -96,14 +436,7 @@ func (s *metrics) houseKeeping() {
 	for {
 		select {
 		case <-ticker:
-			offset := 0
-			for i, stat := range s.stats {
-				if time.Now().Before(stat.time.Add(houseKeepTime)) {
-					offset = i
-					break
-				}
-			}
-			s.clean(offset)
+			s.clean(s.expired(time.Now()))
 		case <-s.stop:
 			logrus.Debugf("stop housekeeping thread")
 			return
@@ -113,80 +446,220 @@ func (s *metrics) houseKeeping() {
 }
 
 func (s *SimpleScale) Scale() error {
-	s.metrics.lock.RLock()
-	defer s.metrics.lock.RUnlock()
-	var total, count, readyPodTotal int
-	for i := len(s.metrics.stats) - 1; i >= len(s.metrics.stats)-12; i-- {
-		if i < 0 {
-			break
-		}
-		total += s.metrics.stats[i].activeRequest
-		count++
-		readyPodTotal += s.metrics.stats[i].readyPods
-	}
-
 	svc, err := s.services.Cache().Get(s.namespace, s.serviceName)
 	if err != nil {
 		return err
 	}
+	// autoscaling may be disabled before OnChange stops this scaler
+	if !autoscaleEnabled(svc) {
+		return nil
+	}
 
 	/*
 		Desired rate is calculated by in-flight requests divided by concurrency.
 		Scale is calculated by desired rate multiplied by desired rate.
 		For example, if current replica is 2, in-flight requests per pod is 30 and concurrency is 10,
 		The desired scale should be 2 * 30 / 10 = 6
+
+		The desired scale is computed over both the stable window and the shorter panic window. Once the panic window
+		asks for PanicThreshold times the ready and starting pods, the scaler panics: it follows the panic window and will not
+		scale down until the panic window has stayed below the threshold for a whole stable window.
+		In rps mode requests per second per pod and the target rps take the place of in-flight requests and concurrency.
+		In latency mode replicas are added by the ratio of the latency quantile of the window to the target latency while
+		the quantile is above the target, and removed one at a time while it stays under half the target.
+		In connections mode open upgraded connections such as WebSockets per pod and the target connections are used.
+		In every mode the scale never drops below the pods holding upgraded connections.
+		Pods count as ready once their Ready condition is true and they are not terminating. While pods are starting the
+		scaler does not scale up further unless the ready and starting pods together are short by the panic threshold.
+		The target is scaled by the target utilization of the policy, except in latency mode where the target is already
+		the latency to stay under.
+		If cpu or memory targets are set the stable scale is the largest of the scale of the mode and the scales needed
+		to keep cpu and memory utilization at their targets. Panic mode only follows the traffic signal.
 	*/
 
-	var desiredScale int32
+	now := time.Now()
+	var target float64
+	switch s.policy.Mode {
+	case RPSMode:
+		target = s.policy.TargetRPS
+	case LatencyMode:
+		target = float64(s.policy.TargetLatency) / float64(time.Millisecond)
+	case ConnectionsMode:
+		target = s.policy.TargetConnections
+	default:
+		target = float64(svc.Spec.Autoscale.Concurrency)
+	}
+	if s.policy.Mode != LatencyMode {
+		target *= s.policy.TargetUtilization
+	}
 
-	if count != 0 {
-		currentReplica := float64(readyPodTotal) / float64(count)
-		if currentReplica == 0 {
-			currentReplica = 1
+	stableScale, stablePods, _ := s.metrics.desiredScale(now, s.policy.StableWindow, s.policy, target)
+	if s.policy.resourceScaling() {
+		if resourceScale := s.metrics.resourceScale(now, s.policy.StableWindow, s.policy); resourceScale > stableScale {
+			stableScale = resourceScale
 		}
+	}
+	panicScale, _, ok := s.metrics.desiredScale(now, s.policy.PanicWindow, s.policy, target)
+	if !ok {
+		panicScale = stableScale
+	}
 
-		var rate float64
-		concurrency := svc.Spec.Autoscale.Concurrency
-		if concurrency == 0 {
-			rate = 1
-		} else {
-			rate = (float64(total) / float64(count)) / float64(concurrency)
+	// pods that are starting already add capacity, so they do not make the scaler panic again. A service without ready
+	// or starting pods panics on a burst held by the gateway, so a cold start scales to the burst at once
+	pendingPods := s.metrics.pendingPods()
+	capacity := math.Max(stablePods+float64(pendingPods), 1)
+	if float64(panicScale)/capacity >= s.policy.PanicThreshold {
+		if s.panicTime.IsZero() {
+			logrus.Infof("entering panic mode for %s/%s, desired scale %v over %v ready pods", s.namespace, s.serviceName, panicScale, stablePods)
 		}
+		s.panicTime = now
+	} else if !s.panicTime.IsZero() && now.Sub(s.panicTime) > s.policy.StableWindow {
+		logrus.Infof("exiting panic mode for %s/%s", s.namespace, s.serviceName)
+		s.panicTime = time.Time{}
+		s.maxPanicScale = 0
+	}
 
-		desiredScale = int32(math.Ceil(currentReplica * rate))
-		logrus.Debugf("average ready pods: %v, scale rate: %v, desired scale: %v", currentReplica, rate, desiredScale)
+	desiredScale := stableScale
+	if !s.panicTime.IsZero() {
+		if panicScale > s.maxPanicScale {
+			s.maxPanicScale = panicScale
+		}
+		desiredScale = s.maxPanicScale
 	}
+	logrus.Debugf("stable desired scale: %v, panic desired scale: %v, panicking: %v", stableScale, panicScale, !s.panicTime.IsZero())
 
-	shouldScale := int(bounded(desiredScale, *svc.Spec.Autoscale.MinReplicas, *svc.Spec.Autoscale.MaxReplicas))
-	if svc.Status.ComputedReplicas != nil && *svc.Status.ComputedReplicas == shouldScale {
+	ssr, err := s.ssrs.Cache().Get(s.namespace, s.serviceName)
+	if errors.IsNotFound(err) {
 		return nil
+	} else if err != nil {
+		return err
 	}
 
-	logrus.Debugf("Updating service to scale %v", shouldScale)
+	// the gateway of another replica raises the recommendation when it activates the service without telling this
+	// scaler, so a raise above the last scale recommended here counts as an activation
+	if ssr.Status.DesiredScale != nil {
+		observed := *ssr.Status.DesiredScale
+		if s.observedScale >= 0 && observed > s.observedScale && int(observed) > s.lastUpdatedScale {
+			logrus.Debugf("service %s/%s was raised to scale %v", s.namespace, s.serviceName, observed)
+			s.metrics.lock.Lock()
+			s.metrics.activate(now, observed)
+			s.metrics.lock.Unlock()
+		}
+		s.observedScale = observed
+	}
+
+	// failed scrapes are added to the total on the recommendation, which outlives this scaler
+	if failures := s.metrics.takeScrapeFailures(); failures > 0 {
+		ssr = ssr.DeepCopy()
+		ssr.Status.ScrapeFailures += failures
+		if ssr, err = s.ssrs.UpdateStatus(ssr); err != nil {
+			s.metrics.countScrapeFailures(int(failures))
+			return err
+		}
+	}
+
+	shouldScale := int(bounded(desiredScale, *svc.Spec.Autoscale.MinReplicas, *svc.Spec.Autoscale.MaxReplicas))
+	// only scale to zero once the service has been idle and no activation is in progress, a service that is already
+	// at zero stays there
+	atZero := ssr.Status.DesiredScale != nil && *ssr.Status.DesiredScale == 0
+	if shouldScale == 0 && !atZero && !s.metrics.idle(now, s.policy.ScaleToZeroIdlePeriod, s.policy.ScaleToZeroGracePeriod) {
+		logrus.Debugf("%s/%s has not been idle long enough to scale to zero", s.namespace, s.serviceName)
+		shouldScale = 1
+	}
+	// never undo a recent activation by the gateway, and scale down from what it raised the recommendation to
+	if floor := int(s.metrics.activationFloor(now, s.policy.ScaleToZeroGracePeriod)); shouldScale < floor {
+		shouldScale = floor
+	}
+	// removing a pod drops the long lived connections it holds
+	if pods := s.metrics.connectionPods(); shouldScale < pods {
+		logrus.Debugf("%v pods of %s/%s hold upgraded connections", pods, s.namespace, s.serviceName)
+		shouldScale = pods
+	}
+	if ssr.Status.DesiredScale != nil && int(*ssr.Status.DesiredScale) > s.lastUpdatedScale {
+		s.lastUpdatedScale = int(*ssr.Status.DesiredScale)
+	}
+	if shouldScale >= s.lastUpdatedScale {
+		s.scaleDownTime = time.Time{}
+	}
+	// while the last scale up is coming online the load of the ready pods overstates what is needed, so only scale up
+	// further if the starting pods would not be enough either
+	if pendingPods > 0 && shouldScale > s.lastUpdatedScale && float64(shouldScale) < capacity*s.policy.PanicThreshold {
+		logrus.Debugf("%v pods of %s/%s are starting, will not scale up from %v to %v", pendingPods, s.namespace, s.serviceName, s.lastUpdatedScale, shouldScale)
+		shouldScale = s.lastUpdatedScale
+	}
+	if ssr.Status.DesiredScale != nil && int(*ssr.Status.DesiredScale) == shouldScale {
+		return nil
+	}
 
 	// prevent scaling down too frequently
 	if shouldScale-s.lastUpdatedScale < 0 {
+		if !s.panicTime.IsZero() {
+			logrus.Debugf("panicking, will not scale down from %v to %v", s.lastUpdatedScale, shouldScale)
+			return nil
+		}
+
+		if s.scaleDownTime.IsZero() {
+			s.scaleDownTime = now
+		}
+		if now.Sub(s.scaleDownTime) < s.policy.ScaleDownDelay {
+			logrus.Debugf("scaling down is delayed until %v", s.scaleDownTime.Add(s.policy.ScaleDownDelay))
+			return nil
+		}
+
+		// latency mode already removes one replica at a time
 		scaleDownRate := s.lastUpdatedScale - shouldScale
-		threshold := int(math.Ceil(float64(s.lastUpdatedScale) / 2.0))
-		if scaleDownRate < threshold {
+		threshold := int(math.Ceil(float64(s.lastUpdatedScale) * s.policy.ScaleDownThreshold))
+		if s.policy.Mode != LatencyMode && scaleDownRate < threshold {
 			logrus.Debugf("scaling down rate %v is less than %v, do no work", scaleDownRate, threshold)
 			return nil
 		}
 	}
 
-	svc.Status.ComputedReplicas = &shouldScale
-	if _, err = s.services.UpdateStatus(svc); err != nil {
+	if step := int(s.policy.MaxScaleUpStep); step > 0 && shouldScale > s.lastUpdatedScale+step {
+		shouldScale = s.lastUpdatedScale + step
+	}
+	if step := int(s.policy.MaxScaleDownStep); step > 0 && shouldScale < s.lastUpdatedScale-step {
+		shouldScale = s.lastUpdatedScale - step
+	}
+	shouldScale = int(bounded(int32(shouldScale), *svc.Spec.Autoscale.MinReplicas, *svc.Spec.Autoscale.MaxReplicas))
+
+	logrus.Debugf("Updating recommendation to scale %v", shouldScale)
+
+	ssr = ssr.DeepCopy()
+	ssr.Status.DesiredScale = &[]int32{int32(shouldScale)}[0]
+	if _, err = s.ssrs.UpdateStatus(ssr); err != nil {
 		return err
 	}
 	s.lastUpdatedScale = shouldScale
 	return nil
 }
 
+func (s *SimpleScale) Policy() Policy {
+	return s.policy
+}
+
+// inherit carries the metric history and scaling state of a stopped SimpleScale over to s
+func (s *SimpleScale) inherit(old *SimpleScale) {
+	old.metrics.lock.RLock()
+	s.metrics.stats = append([]metric(nil), old.metrics.stats...)
+	s.metrics.lastTraffic = old.metrics.lastTraffic
+	s.metrics.lastActivation = old.metrics.lastActivation
+	s.metrics.activationScale = old.metrics.activationScale
+	s.metrics.scrapeFailures = old.metrics.scrapeFailures
+	old.metrics.lock.RUnlock()
+
+	s.lastUpdatedScale = old.lastUpdatedScale
+	s.panicTime = old.panicTime
+	s.maxPanicScale = old.maxPanicScale
+	s.scaleDownTime = old.scaleDownTime
+	s.observedScale = old.observedScale
+}
+
 func (s *SimpleScale) Start() {
 	go s.metrics.houseKeeping()
 
 	go func() {
-		ticker := time.Tick(tickerInterval)
+		ticker := time.Tick(s.policy.ScrapeInterval)
 		for {
 			select {
 			case <-ticker:
@@ -201,13 +674,19 @@ func (s *SimpleScale) Start() {
 	}()
 
 	go func() {
-		ticker := time.Tick(decisionInterval)
+		ticker := time.Tick(s.policy.DecisionInterval)
 		for {
 			select {
 			case <-ticker:
 				if err := s.Scale(); err != nil {
 					logrus.Warnf("Failed to scale for %s/%s, error: %v", s.namespace, s.serviceName, err)
 				}
+				if now := time.Now(); CheckpointInterval > 0 && now.Sub(s.lastCheckpoint) >= CheckpointInterval {
+					if err := s.saveCheckpoint(now); err != nil {
+						logrus.Warnf("Failed to save autoscaler state for %s/%s, error: %v", s.namespace, s.serviceName, err)
+					}
+					s.lastCheckpoint = now
+				}
 			case <-s.stopScaling:
 				logrus.Debugf("Stop autoscaling for %s/%s", s.namespace, s.serviceName)
 				return
@@ -223,16 +702,14 @@ func (s *SimpleScale) Stop() {
 	s.metrics.stop <- struct{}{}
 }
 
-func (s *SimpleScale) ReportMetric() {
+// Activate records that the gateway raised the service to at least scale, the scaler will not recommend less until the
+// scale to zero grace period has passed
+func (s *SimpleScale) Activate(scale int32) {
 	s.metrics.lock.Lock()
 	defer s.metrics.lock.Unlock()
 
-	logrus.Debugf("reporting traffic manually for %s/%s", s.namespace, s.app)
-	s.metrics.stats = append(s.metrics.stats, metric{
-		time:          time.Now(),
-		activeRequest: 1,
-		readyPods:     1,
-	})
+	logrus.Debugf("service %s/%s activated to scale %v", s.namespace, s.serviceName, scale)
+	s.metrics.activate(time.Now(), scale)
 }
 
 func (s *SimpleScale) scrape() error {
@@ -250,82 +727,108 @@ func (s *SimpleScale) scrape() error {
 		return err
 	}
 
-	var totalActiveRequest, inboundActiveRequests, outbountActiveRequests, readyPods int
 	stat := metric{
 		time: time.Now(),
 	}
-	podMap := map[string]*corev1.Pod{}
+	var readyPods []*corev1.Pod
 	for i := range pods {
-		if pods[i].Status.Phase == corev1.PodRunning {
-			podMap[pods[i].Name] = pods[i]
+		switch {
+		case podReady(pods[i]):
+			readyPods = append(readyPods, pods[i])
+		case podStarting(pods[i], stat.time):
+			stat.pendingPods++
 		}
 	}
 
-	for _, pod := range podMap {
-		metricURL := fmt.Sprintf("http://%s:4191/metrics", pod.Status.PodIP)
-		responseTotalMatchCriteria := fmt.Sprintf("response_total{authority=\"%s-%s.%s.svc.cluster.local", s.app, s.version, s.namespace)
-		requestTotalMatchCriteria := fmt.Sprintf("request_total{authority=\"%s-%s.%s.svc.cluster.local", s.app, s.version, s.namespace)
+	observation, err := s.source.Collect(readyPods)
+	if err != nil {
+		// no sample is recorded, it would look like a service without load
+		s.metrics.countScrapeFailures(len(readyPods))
+		return err
+	}
 
-		req, err := http.NewRequest(http.MethodGet, metricURL, nil)
-		if err != nil {
-			return err
-		}
-		resp, err := s.httpClient.Do(req)
+	for pod, err := range observation.ScrapeErrors {
+		logrus.Warnf("Failed to scrape metric of pod %s/%s for %s, error: %v", s.namespace, pod, s.serviceName, err)
+	}
+	stat.scrapeFailures = len(observation.ScrapeErrors)
+	s.metrics.countScrapeFailures(stat.scrapeFailures)
+
+	// per pod values are averaged over the pods that were scraped. Requests held by the gateway for a service with no
+	// ready pods are what the first pod has to serve
+	stat.readyPods = len(readyPods)
+	scraped := float64(stat.scrapedPods())
+	stat.activeRequest = int(float64(observation.ActiveRequests) / scraped)
+	stat.connections = float64(observation.Connections) / scraped
+	stat.connectionPods = connectionPods(observation, len(readyPods))
+	stat.requestCounts = observation.RequestCounts
+	stat.requestRate = s.metrics.requestRate(stat)
+	stat.latencyBuckets = observation.LatencyBuckets
+	stat.latencyDeltas = s.metrics.latencyDeltas(stat)
+
+	if s.policy.resourceScaling() && len(readyPods) > 0 {
+		// a resource that cannot be read does not keep the others from scaling
+		utilization, err := s.resources.Utilization(s.namespace, selector, readyPods, s.policy.resourceNames()...)
 		if err != nil {
-			return nil
+			logrus.Warnf("Failed to read resource metrics for %s/%s, error: %v", s.namespace, s.serviceName, err)
 		}
-		defer resp.Body.Close()
-		scannner := bufio.NewScanner(resp.Body)
-
-		inboundActiveRequests += calculateActiveRequests(scannner, requestTotalMatchCriteria, responseTotalMatchCriteria, true)
-		outbountActiveRequests += calculateActiveRequests(scannner, requestTotalMatchCriteria, responseTotalMatchCriteria, false)
-		readyPods++
+		stat.cpuUtilization = utilization[corev1.ResourceCPU]
+		stat.memoryUtilization = utilization[corev1.ResourceMemory]
 	}
-	totalActiveRequest = inboundActiveRequests + outbountActiveRequests
 
-	if readyPods == 0 {
-		stat.activeRequest = 0
-	} else {
-		stat.activeRequest = int(float64(totalActiveRequest) / float64(readyPods))
+	logrus.Debugf("collect metric for %s/%s, total request: %v, average in-flight request per pod: %v, average rps per pod: %v, ready pod: %v, pending pod: %v, failed scrapes: %v", s.namespace, s.serviceName, observation.ActiveRequests, stat.activeRequest, stat.requestRate, stat.readyPods, stat.pendingPods, stat.scrapeFailures)
+	if observation.ActiveRequests > 0 || observation.Connections > 0 || stat.requestRate > 0 {
+		s.metrics.markTraffic(stat.time)
 	}
-	stat.readyPods = readyPods
-
-	logrus.Debugf("collect metric for %s/%s, total request: %v(inbound %v, outbound %v), average in-flight request per pod: %v, ready pod: %v", s.namespace, s.serviceName, totalActiveRequest, inboundActiveRequests, outbountActiveRequests, stat.activeRequest, readyPods)
-	s.metrics.stats = append(s.metrics.stats, stat)
+	s.metrics.append(stat)
 	return nil
 }
 
-func calculateActiveRequests(scanner *bufio.Scanner, requestMatch, responseMatch string, inbound bool) int {
-	direction := "direction=\"inbound\""
-	if !inbound {
-		direction = "direction=\"outbound\""
+// podReady returns true for pods that pass their readiness checks and are not terminating
+func podReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
 	}
-	var request, response int
-	for scanner.Scan() {
-		if v, ok := match(scanner.Text(), responseMatch, direction); ok {
-			response = v
-		}
-		if v, ok := match(scanner.Text(), requestMatch, direction); ok {
-			request = v
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
 		}
 	}
-	if request-response < 0 {
-		return 0
+	return false
+}
+
+// podStarting returns true for pods that are not ready yet but will add capacity once they are. Pods that are
+// terminating, have completed or were not ready within StartupTimeout of their creation are not expected to
+func podStarting(pod *corev1.Pod, now time.Time) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
 	}
-	return request - response
+	return !podReady(pod) && now.Sub(pod.CreationTimestamp.Time) < StartupTimeout
 }
 
-func match(text, m, direction string) (int, bool) {
-	var result int
-	if strings.Contains(text, m) && strings.Contains(text, direction) {
-		parts := strings.Split(text, " ")
-		if len(parts) == 2 {
-			rqs, _ := strconv.Atoi(parts[1])
-			result = rqs
-			return result, true
+// connectionPods returns the pods holding upgraded connections. Sources that cannot tell which pods hold them are
+// assumed to spread them over as many pods as possible
+func connectionPods(observation metricsource.Observation, readyPods int) int {
+	if observation.PodConnections == nil {
+		if observation.Connections < readyPods {
+			return observation.Connections
 		}
+		return readyPods
+	}
+
+	pods := 0
+	for _, connections := range observation.PodConnections {
+		if connections > 0 {
+			pods++
+		}
+	}
+	return pods
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
 	}
-	return result, false
+	return b
 }
 
 func bounded(value, lower, upper int32) int32 {
@@ -0,0 +1,520 @@
+package servicescale
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	autoscalev1controller "github.com/rancher/rio-autoscaler/pkg/generated/controllers/autoscale.rio.cattle.io/v1"
+	"github.com/rancher/rio-autoscaler/pkg/prometheus"
+	autoscalev1 "github.com/rancher/rio-autoscaler/types/apis/autoscale.rio.cattle.io/v1"
+	riov1 "github.com/rancher/rio/pkg/apis/rio.cattle.io/v1"
+	riov1controller "github.com/rancher/rio/pkg/generated/controllers/rio.cattle.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testStats returns metrics retaining stats for a minute, with one stat at each of ages before now
+func testStats(now time.Time, ages ...time.Duration) *metrics {
+	m := &metrics{
+		retention: time.Minute,
+	}
+	for _, age := range ages {
+		m.stats = append(m.stats, metric{time: now.Add(-age)})
+	}
+	return m
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		ages []time.Duration
+		want int
+	}{
+		{
+			name: "empty",
+			want: 0,
+		},
+		{
+			name: "all fresh",
+			ages: []time.Duration{30 * time.Second, 10 * time.Second},
+			want: 0,
+		},
+		{
+			name: "some expired",
+			ages: []time.Duration{3 * time.Minute, 2 * time.Minute, 30 * time.Second, 10 * time.Second},
+			want: 2,
+		},
+		{
+			name: "all expired",
+			ages: []time.Duration{3 * time.Minute, 2 * time.Minute},
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testStats(now, tt.ages...)
+			if got := m.expired(now); got != tt.want {
+				t.Errorf("expired() = %v, want %v", got, tt.want)
+			}
+			m.clean(m.expired(now))
+			if len(m.stats) != len(tt.ages)-tt.want {
+				t.Errorf("%v stats left, want %v", len(m.stats), len(tt.ages)-tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestRate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		previous *metric
+		current  metric
+		want     float64
+	}{
+		{
+			name:     "counters increased",
+			previous: &metric{time: now.Add(-10 * time.Second), readyPods: 2, requestCounts: map[string]float64{"a": 100, "b": 200}},
+			current:  metric{time: now, readyPods: 2, requestCounts: map[string]float64{"a": 150, "b": 250}},
+			want:     5,
+		},
+		{
+			name:     "counter reset after a pod restart",
+			previous: &metric{time: now.Add(-10 * time.Second), readyPods: 1, requestCounts: map[string]float64{"a": 1000}},
+			current:  metric{time: now, readyPods: 1, requestCounts: map[string]float64{"a": 30}},
+			want:     3,
+		},
+		{
+			name:     "new pod without a previous counter",
+			previous: &metric{time: now.Add(-10 * time.Second), readyPods: 1, requestCounts: map[string]float64{"a": 100}},
+			current:  metric{time: now, readyPods: 2, requestCounts: map[string]float64{"a": 110, "b": 500}},
+			want:     0.5,
+		},
+		{
+			name:     "averaged over scraped pods",
+			previous: &metric{time: now.Add(-10 * time.Second), readyPods: 2, requestCounts: map[string]float64{"a": 100}},
+			current:  metric{time: now, readyPods: 2, scrapeFailures: 1, requestCounts: map[string]float64{"a": 200}},
+			want:     10,
+		},
+		{
+			name:    "no previous metric",
+			current: metric{time: now, readyPods: 1, requestCounts: map[string]float64{"a": 100}},
+			want:    0,
+		},
+		{
+			name:     "no ready pods",
+			previous: &metric{time: now.Add(-10 * time.Second), readyPods: 1, requestCounts: map[string]float64{"a": 100}},
+			current:  metric{time: now, requestCounts: map[string]float64{"a": 200}},
+			want:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &metrics{}
+			if tt.previous != nil {
+				m.stats = []metric{*tt.previous}
+			}
+			if got := m.requestRate(tt.current); got != tt.want {
+				t.Errorf("requestRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDesiredScale(t *testing.T) {
+	now := time.Now()
+	inf := math.Inf(1)
+	tests := []struct {
+		name   string
+		mode   string
+		target float64
+		stats  []metric
+		want   int32
+		wantOK bool
+	}{
+		{
+			name:   "concurrency",
+			mode:   ConcurrencyMode,
+			target: 10,
+			stats: []metric{
+				{time: now.Add(-20 * time.Second), readyPods: 2, activeRequest: 20},
+				{time: now.Add(-10 * time.Second), readyPods: 2, activeRequest: 40},
+			},
+			want:   6,
+			wantOK: true,
+		},
+		{
+			name:   "stats outside the window are ignored",
+			mode:   ConcurrencyMode,
+			target: 10,
+			stats: []metric{
+				{time: now.Add(-2 * time.Minute), readyPods: 2, activeRequest: 100},
+				{time: now.Add(-10 * time.Second), readyPods: 2, activeRequest: 10},
+			},
+			want:   2,
+			wantOK: true,
+		},
+		{
+			name:   "no ready pods count as one",
+			mode:   ConcurrencyMode,
+			target: 10,
+			stats: []metric{
+				{time: now.Add(-5 * time.Second), activeRequest: 200},
+			},
+			want:   20,
+			wantOK: true,
+		},
+		{
+			name:   "rps",
+			mode:   RPSMode,
+			target: 50,
+			stats: []metric{
+				{time: now.Add(-5 * time.Second), readyPods: 3, requestRate: 100},
+			},
+			want:   6,
+			wantOK: true,
+		},
+		{
+			name:   "latency above the target scales up by the ratio",
+			mode:   LatencyMode,
+			target: 100,
+			stats: []metric{
+				{time: now.Add(-5 * time.Second), readyPods: 4, latencyDeltas: prometheus.Buckets{50: 0, 100: 10, 200: 100, inf: 100}},
+			},
+			want:   8,
+			wantOK: true,
+		},
+		{
+			name:   "latency just under the target holds",
+			mode:   LatencyMode,
+			target: 100,
+			stats: []metric{
+				{time: now.Add(-5 * time.Second), readyPods: 4, latencyDeltas: prometheus.Buckets{50: 10, 100: 100, inf: 100}},
+			},
+			want:   4,
+			wantOK: true,
+		},
+		{
+			name:   "latency well under the target removes one replica",
+			mode:   LatencyMode,
+			target: 100,
+			stats: []metric{
+				{time: now.Add(-5 * time.Second), readyPods: 10, latencyDeltas: prometheus.Buckets{20: 100, inf: 100}},
+			},
+			want:   9,
+			wantOK: true,
+		},
+		{
+			name:   "latency without requests",
+			mode:   LatencyMode,
+			target: 100,
+			stats: []metric{
+				{time: now.Add(-5 * time.Second), readyPods: 2},
+			},
+			want:   0,
+			wantOK: true,
+		},
+		{
+			name:   "no target keeps the ready pods",
+			mode:   ConcurrencyMode,
+			target: 0,
+			stats: []metric{
+				{time: now.Add(-5 * time.Second), readyPods: 3, activeRequest: 100},
+			},
+			want:   3,
+			wantOK: true,
+		},
+		{
+			name:   "no stats in the window",
+			mode:   ConcurrencyMode,
+			target: 10,
+			stats: []metric{
+				{time: now.Add(-2 * time.Minute), readyPods: 2, activeRequest: 100},
+			},
+			want:   0,
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &metrics{stats: tt.stats}
+			policy := DefaultPolicy()
+			policy.Mode = tt.mode
+			got, _, ok := m.desiredScale(now, time.Minute, policy, tt.target)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("desiredScale() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+type fakeServices struct {
+	riov1controller.ServiceController
+	svc *riov1.Service
+}
+
+func (f fakeServices) Cache() riov1controller.ServiceCache {
+	return fakeServiceCache{svc: f.svc}
+}
+
+type fakeServiceCache struct {
+	riov1controller.ServiceCache
+	svc *riov1.Service
+}
+
+func (f fakeServiceCache) Get(namespace, name string) (*riov1.Service, error) {
+	return f.svc, nil
+}
+
+// fakeSSRs holds one ServiceScaleRecommendation and records the desired scales it is updated to
+type fakeSSRs struct {
+	autoscalev1controller.ServiceScaleRecommendationController
+	ssr     *autoscalev1.ServiceScaleRecommendation
+	updates []int32
+}
+
+func (f *fakeSSRs) Cache() autoscalev1controller.ServiceScaleRecommendationCache {
+	return fakeSSRCache{ssrs: f}
+}
+
+func (f *fakeSSRs) UpdateStatus(ssr *autoscalev1.ServiceScaleRecommendation) (*autoscalev1.ServiceScaleRecommendation, error) {
+	if ssr.Status.DesiredScale != nil && (f.ssr.Status.DesiredScale == nil || *ssr.Status.DesiredScale != *f.ssr.Status.DesiredScale) {
+		f.updates = append(f.updates, *ssr.Status.DesiredScale)
+	}
+	f.ssr = ssr.DeepCopy()
+	return ssr, nil
+}
+
+type fakeSSRCache struct {
+	autoscalev1controller.ServiceScaleRecommendationCache
+	ssrs *fakeSSRs
+}
+
+func (f fakeSSRCache) Get(namespace, name string) (*autoscalev1.ServiceScaleRecommendation, error) {
+	return f.ssrs.ssr, nil
+}
+
+// testMetric is a metric age before the decision, with perPod in-flight requests on each of ready pods
+type testMetric struct {
+	age            time.Duration
+	perPod         int
+	ready          int
+	pending        int
+	connectionPods int
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      func(p *Policy)
+		minReplicas int32
+		stats       []testMetric
+		// desired is the scale of the recommendation and the last scale recommended before the decision
+		desired int32
+		// panicAge is how long ago the scaler last saw a panic, 0 if it is not panicking
+		panicAge        time.Duration
+		maxPanicScale   int32
+		idleFor         time.Duration
+		activationAge   time.Duration
+		activationScale int32
+
+		want      []int32
+		wantPanic bool
+	}{
+		{
+			name:        "cold start scales to the requests held by the gateway at once",
+			minReplicas: 0,
+			stats:       []testMetric{{age: 2 * time.Second, perPod: 200}},
+			desired:     0,
+			want:        []int32{20},
+			wantPanic:   true,
+		},
+		{
+			name:        "steady load keeps the scale",
+			minReplicas: 1,
+			stats: []testMetric{
+				{age: 50 * time.Second, perPod: 10, ready: 4},
+				{age: 30 * time.Second, perPod: 10, ready: 4},
+				{age: 5 * time.Second, perPod: 10, ready: 4},
+			},
+			desired: 4,
+		},
+		{
+			name:        "burst enters panic and follows the panic window",
+			minReplicas: 1,
+			stats: []testMetric{
+				{age: 50 * time.Second, perPod: 10, ready: 2},
+				{age: 30 * time.Second, perPod: 10, ready: 2},
+				{age: 5 * time.Second, perPod: 50, ready: 2},
+			},
+			desired:   2,
+			want:      []int32{10},
+			wantPanic: true,
+		},
+		{
+			name:        "panicking refuses to scale down",
+			minReplicas: 1,
+			stats: []testMetric{
+				{age: 50 * time.Second, perPod: 2, ready: 10},
+				{age: 30 * time.Second, perPod: 2, ready: 10},
+				{age: 5 * time.Second, perPod: 2, ready: 10},
+			},
+			desired:       10,
+			panicAge:      20 * time.Second,
+			maxPanicScale: 4,
+			wantPanic:     true,
+		},
+		{
+			name:        "panic ends after a calm stable window",
+			minReplicas: 1,
+			stats: []testMetric{
+				{age: 50 * time.Second, perPod: 2, ready: 10},
+				{age: 30 * time.Second, perPod: 2, ready: 10},
+				{age: 5 * time.Second, perPod: 2, ready: 10},
+			},
+			desired:       10,
+			panicAge:      StableWindow + time.Second,
+			maxPanicScale: 10,
+			want:          []int32{2},
+		},
+		{
+			name:        "small scale down is below the threshold",
+			minReplicas: 1,
+			stats:       []testMetric{{age: 5 * time.Second, perPod: 8, ready: 10}},
+			desired:     10,
+		},
+		{
+			name:        "starting pods hold a scale up",
+			minReplicas: 1,
+			stats:       []testMetric{{age: 5 * time.Second, perPod: 15, ready: 2, pending: 2}},
+			desired:     2,
+		},
+		{
+			name: "scale up is limited by the step",
+			policy: func(p *Policy) {
+				p.PanicThreshold = 10
+				p.MaxScaleUpStep = 2
+			},
+			minReplicas: 1,
+			stats:       []testMetric{{age: 5 * time.Second, perPod: 25, ready: 4}},
+			desired:     4,
+			want:        []int32{6},
+		},
+		{
+			name: "pods holding connections are kept",
+			policy: func(p *Policy) {
+				p.ScaleDownThreshold = 0
+			},
+			minReplicas: 1,
+			stats:       []testMetric{{age: 5 * time.Second, ready: 4, connectionPods: 3}},
+			desired:     4,
+			want:        []int32{3},
+		},
+		{
+			name:            "recent activation is not undone",
+			minReplicas:     0,
+			stats:           []testMetric{{age: 5 * time.Second, ready: 3}},
+			desired:         3,
+			activationAge:   5 * time.Second,
+			activationScale: 3,
+		},
+		{
+			name:        "idle service scales to zero",
+			minReplicas: 0,
+			stats:       []testMetric{{age: 5 * time.Second, ready: 1}},
+			desired:     1,
+			idleFor:     10 * time.Minute,
+			want:        []int32{0},
+		},
+		{
+			name:        "service with recent traffic keeps one pod",
+			minReplicas: 0,
+			stats:       []testMetric{{age: 5 * time.Second, ready: 1}},
+			desired:     1,
+		},
+		{
+			name:        "disabled autoscaling makes no decision",
+			minReplicas: 100,
+			stats:       []testMetric{{age: 5 * time.Second, perPod: 200, ready: 1}},
+			desired:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			policy := DefaultPolicy()
+			if tt.policy != nil {
+				tt.policy(&policy)
+			}
+
+			svc := &riov1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "hello",
+					Namespace: "default",
+				},
+				Spec: riov1.ServiceSpec{
+					Autoscale: &riov1.AutoscaleConfig{
+						Concurrency: 10,
+						MinReplicas: &tt.minReplicas,
+						MaxReplicas: &[]int32{100}[0],
+					},
+				},
+			}
+			ssrs := &fakeSSRs{
+				ssr: &autoscalev1.ServiceScaleRecommendation{
+					ObjectMeta: svc.ObjectMeta,
+					Status: autoscalev1.ServiceScaleRecommendationStatus{
+						DesiredScale: &tt.desired,
+					},
+				},
+			}
+
+			s := &SimpleScale{
+				namespace:        svc.Namespace,
+				serviceName:      svc.Name,
+				services:         fakeServices{svc: svc},
+				ssrs:             ssrs,
+				policy:           policy,
+				lastUpdatedScale: int(tt.desired),
+				maxPanicScale:    tt.maxPanicScale,
+				observedScale:    -1,
+				metrics: metrics{
+					retention:       policy.StableWindow,
+					lastTraffic:     now.Add(-tt.idleFor),
+					activationScale: tt.activationScale,
+				},
+			}
+			if tt.panicAge > 0 {
+				s.panicTime = now.Add(-tt.panicAge)
+			}
+			if tt.activationAge > 0 {
+				s.metrics.lastActivation = now.Add(-tt.activationAge)
+			}
+			for _, stat := range tt.stats {
+				s.metrics.stats = append(s.metrics.stats, metric{
+					time:           now.Add(-stat.age),
+					activeRequest:  stat.perPod,
+					readyPods:      stat.ready,
+					pendingPods:    stat.pending,
+					connectionPods: stat.connectionPods,
+				})
+			}
+
+			if err := s.Scale(); err != nil {
+				t.Fatalf("Scale() error = %v", err)
+			}
+			if !reflect.DeepEqual(ssrs.updates, tt.want) {
+				t.Errorf("Scale() updated the recommendation to %v, want %v", ssrs.updates, tt.want)
+			}
+			if panicking := !s.panicTime.IsZero(); panicking != tt.wantPanic {
+				t.Errorf("panicking = %v, want %v", panicking, tt.wantPanic)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package gatewayserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+var (
+	errActivationTimeout = errors.New("timed out waiting for service to become ready")
+	errQueueFull         = errors.New("too many requests waiting for service to become ready")
+)
+
+// activator holds requests for a service until the endpoints of the service have a ready address
+type activator struct {
+	lock      sync.Mutex
+	waiters   map[string][]chan struct{}
+	activated map[string]time.Time
+	group     singleflight.Group
+	maxQueue  int
+	endpoints corev1controller.EndpointsCache
+}
+
+func newActivator(ctx context.Context, endpoints corev1controller.EndpointsController, maxQueue int) *activator {
+	a := &activator{
+		waiters:   map[string][]chan struct{}{},
+		activated: map[string]time.Time{},
+		maxQueue:  maxQueue,
+		endpoints: endpoints.Cache(),
+	}
+	endpoints.OnChange(ctx, "gateway-activator", a.onEndpointsChange)
+	return a
+}
+
+func (a *activator) onEndpointsChange(key string, ep *corev1.Endpoints) (*corev1.Endpoints, error) {
+	if ep == nil || !endpointsReady(ep) {
+		return ep, nil
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.activated, key)
+	if waiters := a.waiters[key]; len(waiters) > 0 {
+		logrus.Debugf("endpoints %s are ready, releasing %v requests", key, len(waiters))
+		for _, ch := range waiters {
+			close(ch)
+		}
+		delete(a.waiters, key)
+	}
+	return ep, nil
+}
+
+// activate calls scaleUp once per cold start of the endpoints called name in namespace. Concurrent callers wait for and
+// share the result of the same call, and later callers skip it until the endpoints become ready or timeout has passed
+func (a *activator) activate(namespace, name string, timeout time.Duration, scaleUp func() error) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if a.activating(key, timeout) {
+		return nil
+	}
+
+	ep, err := a.endpoints.Get(namespace, name)
+	if err == nil && endpointsReady(ep) {
+		return nil
+	}
+
+	_, err, _ = a.group.Do(key, func() (interface{}, error) {
+		if a.activating(key, timeout) {
+			return nil, nil
+		}
+		if err := scaleUp(); err != nil {
+			return nil, err
+		}
+		a.lock.Lock()
+		a.activated[key] = time.Now()
+		a.lock.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+func (a *activator) activating(key string, timeout time.Duration) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	t, ok := a.activated[key]
+	return ok && time.Since(t) < timeout
+}
+
+// wait blocks until the endpoints called name in namespace have a ready address, ctx is done or timeout has passed.
+// It returns errQueueFull right away if too many requests are already waiting for the endpoints
+func (a *activator) wait(ctx context.Context, namespace, name string, timeout time.Duration) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+
+	a.lock.Lock()
+	ep, err := a.endpoints.Get(namespace, name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		a.lock.Unlock()
+		return err
+	}
+	if err == nil && endpointsReady(ep) {
+		a.lock.Unlock()
+		return nil
+	}
+	if a.maxQueue > 0 && len(a.waiters[key]) >= a.maxQueue {
+		a.lock.Unlock()
+		return errQueueFull
+	}
+	ch := make(chan struct{})
+	a.waiters[key] = append(a.waiters[key], ch)
+	a.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		a.remove(key, ch)
+		return ctx.Err()
+	case <-timer.C:
+		a.remove(key, ch)
+		return errActivationTimeout
+	}
+}
+
+func (a *activator) remove(key string, ch chan struct{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	waiters := a.waiters[key]
+	for i := range waiters {
+		if waiters[i] == ch {
+			a.waiters[key] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(a.waiters[key]) == 0 {
+		delete(a.waiters, key)
+	}
+}
+
+func endpointsReady(ep *corev1.Endpoints) bool {
+	for _, subset := range ep.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true
+		}
+	}
+	return false
+}
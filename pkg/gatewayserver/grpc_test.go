@@ -0,0 +1,318 @@
+package gatewayserver
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/rancher/rio-autoscaler/pkg/controllers/servicescale"
+	"github.com/rancher/rio-autoscaler/pkg/metricsource"
+	riov1 "github.com/rancher/rio/pkg/apis/rio.cattle.io/v1"
+	riov1controller "github.com/rancher/rio/pkg/generated/controllers/rio.cattle.io/v1"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// echoService is a gRPC service with a unary and a bidirectional streaming method echoing string values. Both set the
+// x-echo trailer, and the unary method fails with FAILED_PRECONDITION on "fail"
+var echoService = grpc.ServiceDesc{
+	ServiceName: "gatewayserver.test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Unary",
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &wrappers.StringValue{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if err := grpc.SetTrailer(ctx, metadata.Pairs("x-echo", "unary")); err != nil {
+					return nil, err
+				}
+				if in.Value == "fail" {
+					return nil, status.Error(codes.FailedPrecondition, "asked to fail")
+				}
+				return in, nil
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Stream",
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				for {
+					in := &wrappers.StringValue{}
+					if err := stream.RecvMsg(in); err == io.EOF {
+						stream.SetTrailer(metadata.Pairs("x-echo", "stream"))
+						return nil
+					} else if err != nil {
+						return err
+					}
+					if err := stream.SendMsg(in); err != nil {
+						return err
+					}
+				}
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+var echoStream = &grpc.StreamDesc{
+	StreamName:    "Stream",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+type fakeServiceCache struct {
+	riov1controller.ServiceCache
+	services map[string]*riov1.Service
+}
+
+func (f fakeServiceCache) Get(namespace, name string) (*riov1.Service, error) {
+	if svc, ok := f.services[namespace+"/"+name]; ok {
+		return svc, nil
+	}
+	return nil, apierrors.NewNotFound(riov1.Resource("services"), name)
+}
+
+type fakeEndpointsCache struct {
+	corev1controller.EndpointsCache
+}
+
+// Get returns ready endpoints, so requests are proxied without activation
+func (fakeEndpointsCache) Get(namespace, name string) (*corev1.Endpoints, error) {
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "127.0.0.1"}},
+			},
+		},
+	}, nil
+}
+
+func (fakeEndpointsCache) List(string, labels.Selector) ([]*corev1.Endpoints, error) {
+	return nil, nil
+}
+
+// newTestGateway returns a gateway in front of the service echo in namespace default, exposing port 8080 with protocol,
+// and a func stopping it. Every h2c backend connection of the gateway is dialed to backend
+func newTestGateway(backend string, protocol riov1.Protocol) (*httptest.Server, func()) {
+	previous := http2Transport
+	http2Transport = &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, _ string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, backend)
+		},
+	}
+
+	services := fakeServiceCache{
+		services: map[string]*riov1.Service{
+			"default/echo": {
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "echo",
+					Namespace: "default",
+				},
+				Spec: riov1.ServiceSpec{
+					App:     "echo",
+					Version: "v0",
+					PodConfig: riov1.PodConfig{
+						Container: riov1.Container{
+							Image: "echo",
+							Ports: []riov1.ContainerPort{
+								{
+									Port:     8080,
+									Protocol: protocol,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	handler := Handler{
+		serviceCache: services,
+		resolver: &resolver{
+			services: services,
+		},
+		activator: &activator{
+			waiters:   map[string][]chan struct{}{},
+			activated: map[string]time.Time{},
+			endpoints: fakeEndpointsCache{},
+		},
+		limiter:     newLimiter(0, 0),
+		requests:    metricsource.NewGatewayRequests(),
+		opts:        Options{ActivationTimeout: time.Second},
+		lock:        &sync.RWMutex{},
+		autoscalers: map[string]*servicescale.SimpleScale{},
+	}
+
+	gateway := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	return gateway, func() {
+		gateway.Close()
+		http2Transport = previous
+	}
+}
+
+// dialEcho starts the echo service and a gateway in front of it with the echo port declared as protocol, and returns a
+// connection to the gateway and a func stopping all of them
+func dialEcho(t *testing.T, protocol riov1.Protocol) (*grpc.ClientConn, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&echoService, struct{}{})
+	go server.Serve(listener)
+
+	gateway, stopGateway := newTestGateway(listener.Addr().String(), protocol)
+	conn, err := grpc.Dial(gateway.Listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		stopGateway()
+		server.Stop()
+	}
+}
+
+func echoContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	return metadata.AppendToOutgoingContext(ctx, "x-rio-servicename", "echo", "x-rio-namespace", "default"), cancel
+}
+
+func TestGRPCUnary(t *testing.T) {
+	conn, stop := dialEcho(t, riov1.ProtocolGRPC)
+	defer stop()
+	ctx, cancel := echoContext()
+	defer cancel()
+
+	var trailer metadata.MD
+	out := &wrappers.StringValue{}
+	if err := conn.Invoke(ctx, "/gatewayserver.test.Echo/Unary", &wrappers.StringValue{Value: "hello"}, out, grpc.Trailer(&trailer)); err != nil {
+		t.Fatalf("Unary() error = %v", err)
+	}
+	if out.Value != "hello" {
+		t.Errorf("Unary() = %q, want hello", out.Value)
+	}
+	if got := trailer.Get("x-echo"); len(got) != 1 || got[0] != "unary" {
+		t.Errorf("trailer x-echo = %v, want unary", got)
+	}
+
+	err := conn.Invoke(ctx, "/gatewayserver.test.Echo/Unary", &wrappers.StringValue{Value: "fail"}, out, grpc.Trailer(&trailer))
+	if s, _ := status.FromError(err); s.Code() != codes.FailedPrecondition || s.Message() != "asked to fail" {
+		t.Errorf("Unary() error = %v, want FailedPrecondition from the grpc-status trailer", err)
+	}
+	if got := trailer.Get("x-echo"); len(got) != 1 || got[0] != "unary" {
+		t.Errorf("trailer x-echo of failed call = %v, want unary", got)
+	}
+}
+
+func TestGRPCStream(t *testing.T) {
+	conn, stop := dialEcho(t, riov1.ProtocolGRPC)
+	defer stop()
+	ctx, cancel := echoContext()
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, echoStream, "/gatewayserver.test.Echo/Stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every message is echoed before the next one is sent, so responses must be streamed back as they arrive
+	for _, value := range []string{"one", "two", "three"} {
+		if err := stream.SendMsg(&wrappers.StringValue{Value: value}); err != nil {
+			t.Fatalf("SendMsg(%q) error = %v", value, err)
+		}
+		out := &wrappers.StringValue{}
+		if err := stream.RecvMsg(out); err != nil {
+			t.Fatalf("RecvMsg() error = %v", err)
+		}
+		if out.Value != value {
+			t.Errorf("RecvMsg() = %q, want %q", out.Value, value)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.RecvMsg(&wrappers.StringValue{}); err != io.EOF {
+		t.Fatalf("RecvMsg() after CloseSend error = %v, want EOF", err)
+	}
+	if got := stream.Trailer().Get("x-echo"); len(got) != 1 || got[0] != "stream" {
+		t.Errorf("trailer x-echo = %v, want stream", got)
+	}
+}
+
+// TestGRPCPortWithoutProtocol proxies to a port without a declared protocol, which follows the HTTP/2 of the request
+func TestGRPCPortWithoutProtocol(t *testing.T) {
+	conn, stop := dialEcho(t, "")
+	defer stop()
+	ctx, cancel := echoContext()
+	defer cancel()
+
+	out := &wrappers.StringValue{}
+	if err := conn.Invoke(ctx, "/gatewayserver.test.Echo/Unary", &wrappers.StringValue{Value: "hello"}, out); err != nil {
+		t.Fatalf("Unary() error = %v", err)
+	}
+	if out.Value != "hello" {
+		t.Errorf("Unary() = %q, want hello", out.Value)
+	}
+}
+
+func TestGRPCBackendUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := listener.Addr().String()
+	listener.Close()
+
+	gateway, stopGateway := newTestGateway(backend, riov1.ProtocolGRPC)
+	defer stopGateway()
+	conn, err := grpc.Dial(gateway.Listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := echoContext()
+	defer cancel()
+
+	err = conn.Invoke(ctx, "/gatewayserver.test.Echo/Unary", &wrappers.StringValue{Value: "hello"}, &wrappers.StringValue{})
+	if s, _ := status.FromError(err); s.Code() != codes.Unavailable {
+		t.Errorf("Unary() error = %v, want Unavailable", err)
+	}
+}
+
+func TestGRPCMessageEncode(t *testing.T) {
+	if got, want := grpcMessageEncode("dial tcp: 100% refused\n"), "dial tcp: 100%25 refused%0A"; got != want {
+		t.Errorf("grpcMessageEncode() = %q, want %q", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	grpcError(w, grpcUnavailable, "down")
+	if w.Code != http.StatusOK || w.Header().Get("Grpc-Status") != "14" || w.Header().Get("Grpc-Message") != "down" {
+		t.Errorf("grpcError() = %v %v, want 200 with grpc-status 14", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,51 @@
+package gatewayserver
+
+import (
+	"net/http"
+	"sync"
+)
+
+// limiter bounds the requests the gateway holds for each service and in total
+type limiter struct {
+	lock          sync.Mutex
+	maxPerService int
+	maxTotal      int
+	perService    map[string]int
+	total         int
+}
+
+func newLimiter(maxPerService, maxTotal int) *limiter {
+	return &limiter{
+		maxPerService: maxPerService,
+		maxTotal:      maxTotal,
+		perService:    map[string]int{},
+	}
+}
+
+// acquire reserves a slot for a request to the service key. It returns false with a status code to reject the request
+// with if the service or the gateway is at its limit. A limit of 0 means unlimited
+func (l *limiter) acquire(key string) (bool, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return false, http.StatusServiceUnavailable
+	}
+	if l.maxPerService > 0 && l.perService[key] >= l.maxPerService {
+		return false, http.StatusTooManyRequests
+	}
+	l.total++
+	l.perService[key]++
+	return true, 0
+}
+
+func (l *limiter) release(key string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.total--
+	l.perService[key]--
+	if l.perService[key] <= 0 {
+		delete(l.perService, key)
+	}
+}
@@ -0,0 +1,175 @@
+package gatewayserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/rio/modules/service/controllers/service/populate/serviceports"
+	riov1 "github.com/rancher/rio/pkg/apis/rio.cattle.io/v1"
+	"github.com/rancher/rio/pkg/riofile/stringers"
+	"github.com/rancher/rio/pkg/services"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+const (
+	// PortAnnotation selects the port of a service the gateway proxies to
+	PortAnnotation = "autoscale.rio.cattle.io/gateway-port"
+	// PathPortsAnnotation maps path prefixes to ports of a service, such as /api=8080,/=80. The longest matching prefix wins
+	PathPortsAnnotation = "autoscale.rio.cattle.io/gateway-path-ports"
+	// ProtocolAnnotation is the protocol the gateway speaks to a service, http1, h2c or https, grpc is the same as h2c
+	ProtocolAnnotation = "autoscale.rio.cattle.io/gateway-protocol"
+
+	protocolHTTP1 = "http1"
+	protocolH2C   = "h2c"
+	protocolHTTPS = "https"
+)
+
+// selectPort returns the HTTP port of svc a request is proxied to. In order of precedence it is the port mapped to the
+// path of the request by PathPortsAnnotation, the port set by PortAnnotation, the exposed HTTP port the request came
+// in on, and the first exposed HTTP port of the service
+func selectPort(svc *riov1.Service, r *http.Request) (riov1.ContainerPort, error) {
+	var candidates []riov1.ContainerPort
+	for _, port := range serviceports.ContainerPorts(svc) {
+		if proxiable(port) {
+			candidates = append(candidates, port)
+		}
+	}
+	if len(candidates) == 0 {
+		return riov1.ContainerPort{}, fmt.Errorf("service %s/%s exposes no HTTP port", svc.Namespace, svc.Name)
+	}
+
+	if value, ok := svc.Annotations[PathPortsAnnotation]; ok {
+		port, ok, err := pathPort(value, r.URL.Path)
+		if err != nil {
+			return riov1.ContainerPort{}, fmt.Errorf("invalid annotation %s of service %s/%s: %v", PathPortsAnnotation, svc.Namespace, svc.Name, err)
+		}
+		if ok {
+			return findPort(svc, candidates, port)
+		}
+	}
+
+	if value, ok := svc.Annotations[PortAnnotation]; ok {
+		port, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return riov1.ContainerPort{}, fmt.Errorf("invalid annotation %s of service %s/%s: %v", PortAnnotation, svc.Namespace, svc.Name, err)
+		}
+		return findPort(svc, candidates, int32(port))
+	}
+
+	if port, ok := incomingPort(r); ok {
+		if p, err := findPort(svc, candidates, port); err == nil {
+			return p, nil
+		}
+	}
+
+	return candidates[0], nil
+}
+
+// proxiable returns true for exposed HTTP ports, gRPC ports are exposed unless set otherwise
+func proxiable(port riov1.ContainerPort) bool {
+	if port.Protocol == riov1.ProtocolGRPC {
+		return port.Expose == nil || *port.Expose
+	}
+	return port.IsExposed() && port.IsHTTP()
+}
+
+// backendProtocol returns the protocol requests to port of svc are proxied with. ProtocolAnnotation takes precedence
+// over the protocol and name of the port, ports without either follow the protocol of the request
+func backendProtocol(svc *riov1.Service, port riov1.ContainerPort, r *http.Request) (string, error) {
+	if value, ok := svc.Annotations[ProtocolAnnotation]; ok {
+		switch protocol := strings.ToLower(value); protocol {
+		case protocolHTTP1, protocolH2C, protocolHTTPS:
+			return downgradeUpgrade(protocol, r), nil
+		case "grpc":
+			return downgradeUpgrade(protocolH2C, r), nil
+		}
+		return "", fmt.Errorf("invalid annotation %s of service %s/%s: unknown protocol %s", ProtocolAnnotation, svc.Namespace, svc.Name, value)
+	}
+
+	switch {
+	case strings.HasPrefix(strings.ToLower(port.Name), "https"):
+		return protocolHTTPS, nil
+	case port.Protocol == riov1.ProtocolHTTP2 || port.Protocol == riov1.ProtocolGRPC:
+		return downgradeUpgrade(protocolH2C, r), nil
+	case port.Protocol == riov1.ProtocolHTTP && declaredProtocol(svc, port) == riov1.ProtocolHTTP:
+		return protocolHTTP1, nil
+	case r.ProtoMajor == 2:
+		return downgradeUpgrade(protocolH2C, r), nil
+	}
+	return protocolHTTP1, nil
+}
+
+// declaredProtocol returns the protocol port was declared with in the containers of svc. Ports without a protocol are
+// HTTP once normalized, so this tells them apart from ports declared as HTTP
+func declaredProtocol(svc *riov1.Service, port riov1.ContainerPort) riov1.Protocol {
+	for _, container := range services.ToNamedContainers(svc) {
+		for _, p := range container.Ports {
+			if normalized := stringers.NormalizeContainerPort(p); normalized.Port == port.Port && normalized.Protocol == port.Protocol {
+				return p.Protocol
+			}
+		}
+	}
+	return port.Protocol
+}
+
+// downgradeUpgrade returns http1 instead of h2c for connection upgrades, which only exist in HTTP/1
+func downgradeUpgrade(protocol string, r *http.Request) string {
+	if protocol == protocolH2C && httpstream.IsUpgradeRequest(r) {
+		return protocolHTTP1
+	}
+	return protocol
+}
+
+func findPort(svc *riov1.Service, candidates []riov1.ContainerPort, port int32) (riov1.ContainerPort, error) {
+	for _, p := range candidates {
+		if p.Port == port {
+			return p, nil
+		}
+	}
+	return riov1.ContainerPort{}, fmt.Errorf("port %d is not an exposed HTTP port of service %s/%s", port, svc.Namespace, svc.Name)
+}
+
+// pathPort returns the port of the longest path prefix in value matching path
+func pathPort(value, path string) (int32, bool, error) {
+	var (
+		port    int32
+		longest = -1
+	)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return 0, false, fmt.Errorf("entry %q is not path=port", entry)
+		}
+		p, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 32)
+		if err != nil {
+			return 0, false, fmt.Errorf("entry %q: %v", entry, err)
+		}
+		prefix := strings.TrimSpace(parts[0])
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			port, longest = int32(p), len(prefix)
+		}
+	}
+	return port, longest >= 0, nil
+}
+
+// incomingPort returns the port of the Host of r, or else the local port the request was accepted on
+func incomingPort(r *http.Request) (int32, bool) {
+	if _, port, err := net.SplitHostPort(r.Host); err == nil {
+		if p, err := strconv.ParseInt(port, 10, 32); err == nil {
+			return int32(p), true
+		}
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if tcp, ok := addr.(*net.TCPAddr); ok {
+			return int32(tcp.Port), true
+		}
+	}
+	return 0, false
+}
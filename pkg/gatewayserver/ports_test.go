@@ -0,0 +1,109 @@
+package gatewayserver
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	riov1 "github.com/rancher/rio/pkg/apis/rio.cattle.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBackendProtocol(t *testing.T) {
+	tests := []struct {
+		name        string
+		port        riov1.ContainerPort
+		annotations map[string]string
+		protoMajor  int
+		upgrade     bool
+		want        string
+	}{
+		{
+			name:       "no protocol over HTTP/1",
+			port:       riov1.ContainerPort{Port: 8080},
+			protoMajor: 1,
+			want:       protocolHTTP1,
+		},
+		{
+			name:       "no protocol over HTTP/2",
+			port:       riov1.ContainerPort{Port: 8080},
+			protoMajor: 2,
+			want:       protocolH2C,
+		},
+		{
+			name:       "no protocol upgrade over HTTP/2",
+			port:       riov1.ContainerPort{Port: 8080},
+			protoMajor: 2,
+			upgrade:    true,
+			want:       protocolHTTP1,
+		},
+		{
+			name:       "http over HTTP/2",
+			port:       riov1.ContainerPort{Port: 8080, Protocol: riov1.ProtocolHTTP},
+			protoMajor: 2,
+			want:       protocolHTTP1,
+		},
+		{
+			name:       "http2 over HTTP/1",
+			port:       riov1.ContainerPort{Port: 8080, Protocol: riov1.ProtocolHTTP2},
+			protoMajor: 1,
+			want:       protocolH2C,
+		},
+		{
+			name:       "grpc",
+			port:       riov1.ContainerPort{Port: 8080, Protocol: riov1.ProtocolGRPC},
+			protoMajor: 2,
+			want:       protocolH2C,
+		},
+		{
+			name:       "https name",
+			port:       riov1.ContainerPort{Name: "https-web", Port: 8443},
+			protoMajor: 2,
+			want:       protocolHTTPS,
+		},
+		{
+			name:        "annotation",
+			port:        riov1.ContainerPort{Port: 8080, Protocol: riov1.ProtocolHTTP},
+			annotations: map[string]string{ProtocolAnnotation: "grpc"},
+			protoMajor:  1,
+			want:        protocolH2C,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &riov1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "web",
+					Namespace:   "default",
+					Annotations: tt.annotations,
+				},
+				Spec: riov1.ServiceSpec{
+					PodConfig: riov1.PodConfig{
+						Container: riov1.Container{
+							Image: "web",
+							Ports: []riov1.ContainerPort{tt.port},
+						},
+					},
+				},
+			}
+			port, err := selectPort(svc, httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.ProtoMajor = tt.protoMajor
+			if tt.upgrade {
+				r.Header.Set("Connection", "Upgrade")
+				r.Header.Set("Upgrade", "websocket")
+			}
+			got, err := backendProtocol(svc, port, r)
+			if err != nil {
+				t.Fatalf("backendProtocol() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("backendProtocol() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
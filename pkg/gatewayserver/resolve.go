@@ -0,0 +1,235 @@
+package gatewayserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/rancher/rio-autoscaler/types"
+	adminv1 "github.com/rancher/rio/pkg/apis/admin.rio.cattle.io/v1"
+	riov1 "github.com/rancher/rio/pkg/apis/rio.cattle.io/v1"
+	adminv1controller "github.com/rancher/rio/pkg/generated/controllers/admin.rio.cattle.io/v1"
+	riov1controller "github.com/rancher/rio/pkg/generated/controllers/rio.cattle.io/v1"
+	"github.com/rancher/rio/pkg/services"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	serviceHostIndex = "gateway.autoscale.rio.cattle.io/service-host"
+	serviceAppIndex  = "gateway.autoscale.rio.cattle.io/service-app"
+	routerHostIndex  = "gateway.autoscale.rio.cattle.io/router-host"
+)
+
+var errNoTarget = errors.New("request has no target service")
+
+// notFoundError is returned by resolve when the target of a request does not exist
+type notFoundError struct {
+	target string
+}
+
+func (e notFoundError) Error() string {
+	return fmt.Sprintf("%s not found", e.target)
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(notFoundError)
+	return ok || err == errNoTarget
+}
+
+// resolver finds the service a request is for, either from the X-Rio-* headers or from the Host of the request
+type resolver struct {
+	services      riov1controller.ServiceCache
+	routers       riov1controller.RouterCache
+	publicDomains adminv1controller.PublicDomainCache
+}
+
+func newResolver(rContext *types.Context) *resolver {
+	r := &resolver{
+		services:      rContext.Rio.Rio().V1().Service().Cache(),
+		routers:       rContext.Rio.Rio().V1().Router().Cache(),
+		publicDomains: rContext.Admin.Admin().V1().PublicDomain().Cache(),
+	}
+	r.services.AddIndexer(serviceHostIndex, func(svc *riov1.Service) ([]string, error) {
+		return hosts(append(svc.Status.Endpoints, svc.Status.AppEndpoints...)), nil
+	})
+	r.services.AddIndexer(serviceAppIndex, func(svc *riov1.Service) ([]string, error) {
+		app, _ := services.AppAndVersion(svc)
+		return []string{appKey(svc.Namespace, app)}, nil
+	})
+	r.routers.AddIndexer(routerHostIndex, func(router *riov1.Router) ([]string, error) {
+		return hosts(router.Status.Endpoints), nil
+	})
+	return r
+}
+
+// resolve returns the service req is for. The X-Rio-* headers take precedence, otherwise the Host of req is matched
+// against the app and version endpoints of services, the endpoints of routers and public domains
+func (r *resolver) resolve(req *http.Request) (*riov1.Service, error) {
+	name := req.Header.Get(RioNameHeader)
+	namespace := req.Header.Get(RioNamespaceHeader)
+	if name != "" || namespace != "" {
+		if name == "" || namespace == "" {
+			return nil, errNoTarget
+		}
+		return r.service(namespace, name)
+	}
+
+	host := requestHost(req)
+	if host == "" {
+		return nil, errNoTarget
+	}
+
+	svcs, err := r.services.GetByIndex(serviceHostIndex, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(svcs) > 0 {
+		return pickService(svcs, host), nil
+	}
+
+	routers, err := r.routers.GetByIndex(routerHostIndex, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(routers) > 0 {
+		return r.route(routers[0], req.URL.Path)
+	}
+
+	domain, err := r.publicDomains.Get(host)
+	if apierrors.IsNotFound(err) {
+		return nil, notFoundError{target: fmt.Sprintf("host %s", host)}
+	} else if err != nil {
+		return nil, err
+	}
+	return r.publicDomain(domain, req.URL.Path)
+}
+
+func (r *resolver) service(namespace, name string) (*riov1.Service, error) {
+	svc, err := r.services.Get(namespace, name)
+	if apierrors.IsNotFound(err) {
+		return nil, notFoundError{target: fmt.Sprintf("service %s/%s", namespace, name)}
+	}
+	return svc, err
+}
+
+// appVersion returns the service of app and version in namespace, or the service of app with the highest weight if
+// version is empty
+func (r *resolver) appVersion(namespace, app, version string) (*riov1.Service, error) {
+	svcs, err := r.services.GetByIndex(serviceAppIndex, appKey(namespace, app))
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		if len(svcs) == 0 {
+			return nil, notFoundError{target: fmt.Sprintf("app %s/%s", namespace, app)}
+		}
+		return pickService(svcs, ""), nil
+	}
+	for _, svc := range svcs {
+		if _, v := services.AppAndVersion(svc); v == version {
+			return svc, nil
+		}
+	}
+	return nil, notFoundError{target: fmt.Sprintf("version %s of app %s/%s", version, namespace, app)}
+}
+
+// route returns the service of the destination with the highest weight of the first route of router matching path
+func (r *resolver) route(router *riov1.Router, path string) (*riov1.Service, error) {
+	for _, route := range router.Spec.Routes {
+		if !matchPath(route.Match.Path, path) || len(route.To) == 0 {
+			continue
+		}
+		to := route.To[0]
+		for _, dest := range route.To[1:] {
+			if dest.Weight > to.Weight {
+				to = dest
+			}
+		}
+		return r.appVersion(router.Namespace, to.App, to.Version)
+	}
+	return nil, notFoundError{target: fmt.Sprintf("route for %s in router %s/%s", path, router.Namespace, router.Name)}
+}
+
+func (r *resolver) publicDomain(domain *adminv1.PublicDomain, path string) (*riov1.Service, error) {
+	namespace := domain.Spec.TargetNamespace
+	if domain.Spec.TargetRouter != "" {
+		router, err := r.routers.Get(namespace, domain.Spec.TargetRouter)
+		if apierrors.IsNotFound(err) {
+			return nil, notFoundError{target: fmt.Sprintf("router %s/%s", namespace, domain.Spec.TargetRouter)}
+		} else if err != nil {
+			return nil, err
+		}
+		return r.route(router, path)
+	}
+	return r.appVersion(namespace, domain.Spec.TargetApp, domain.Spec.TargetVersion)
+}
+
+// pickService returns the service whose version endpoints include host, or else the one with the highest weight
+func pickService(svcs []*riov1.Service, host string) *riov1.Service {
+	var result *riov1.Service
+	for _, svc := range svcs {
+		for _, h := range hosts(svc.Status.Endpoints) {
+			if h == host {
+				return svc
+			}
+		}
+		if result == nil || weight(svc) > weight(result) {
+			result = svc
+		}
+	}
+	return result
+}
+
+func weight(svc *riov1.Service) int {
+	if svc.Status.ComputedWeight != nil {
+		return *svc.Status.ComputedWeight
+	}
+	if svc.Spec.Weight != nil {
+		return *svc.Spec.Weight
+	}
+	return 0
+}
+
+func matchPath(match *riov1.StringMatch, path string) bool {
+	switch {
+	case match == nil:
+		return true
+	case match.Exact != "":
+		return path == match.Exact
+	case match.Prefix != "":
+		return strings.HasPrefix(path, match.Prefix)
+	case match.Regexp != "":
+		ok, err := regexp.MatchString(match.Regexp, path)
+		return err == nil && ok
+	}
+	return true
+}
+
+// hosts returns the lower cased hosts of endpoint URLs without their ports
+func hosts(endpoints []string) []string {
+	var result []string
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		result = append(result, strings.ToLower(u.Hostname()))
+	}
+	return result
+}
+
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func appKey(namespace, app string) string {
+	return fmt.Sprintf("%s/%s", namespace, app)
+}
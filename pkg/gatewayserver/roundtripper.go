@@ -21,30 +21,10 @@ import (
 	"golang.org/x/net/http2"
 )
 
-type roundTripperFunc func(*http.Request) (*http.Response, error)
-
-func (rt roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
-	return rt(r)
-}
-
-// NewHttpTransport will use the appropriate transport for the request's HTTP protocol version
-func newHTTPTransport(v1 http.RoundTripper, v2 http.RoundTripper) http.RoundTripper {
-	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
-		t := v1
-		if r.ProtoMajor == 2 {
-			t = v2
-		}
-
-		return t.RoundTrip(r)
-	})
-}
-
+// http2Transport speaks HTTP/2 without TLS (h2c) to backends
 var http2Transport http.RoundTripper = &http2.Transport{
 	AllowHTTP: true,
 	DialTLS: func(netw, addr string, cfg *tls.Config) (net.Conn, error) {
 		return net.Dial(netw, addr)
 	},
 }
-
-// AutoTransport uses h2c for HTTP2 requests and falls back to `http.DefaultTransport` for all others
-var autoTransport = newHTTPTransport(http.DefaultTransport, http2Transport)
@@ -0,0 +1,109 @@
+package gatewayserver
+
+import (
+	"encoding/json"
+	"fmt"
+
+	riov1 "github.com/rancher/rio/pkg/apis/rio.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+// scaleUp raises the scale of a service to at least the activation scale. The scale is never lowered, so a request
+// for a service that is already running more replicas does not scale it down. The autoscaler of the service is told
+// about the activation first so its next decision does not undo it. Only the ServiceScaleRecommendation is raised,
+// the computed replicas of the service are only raised for services that have none
+func (h Handler) scaleUp(namespace, name string) error {
+	svc, err := h.serviceCache.Get(namespace, name)
+	if err != nil {
+		return err
+	}
+	scale := h.activationScale(svc)
+
+	h.lock.RLock()
+	sc, ok := h.autoscalers[fmt.Sprintf("%s/%s", namespace, name)]
+	h.lock.RUnlock()
+	if ok {
+		sc.Activate(scale)
+	}
+
+	found, err := h.raiseRecommendation(namespace, name, scale)
+	if err != nil || found {
+		return err
+	}
+	return h.raiseComputedReplicas(namespace, name, scale)
+}
+
+func (h Handler) activationScale(svc *riov1.Service) int32 {
+	scale := int32(h.opts.ActivationScale)
+	if scale < 1 {
+		scale = 1
+	}
+	if autoscale := svc.Spec.Autoscale; autoscale != nil && autoscale.MaxReplicas != nil && *autoscale.MaxReplicas > 0 && scale > *autoscale.MaxReplicas {
+		scale = *autoscale.MaxReplicas
+	}
+	return scale
+}
+
+func (h Handler) raiseComputedReplicas(namespace, name string, scale int32) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		svc, err := h.services.Get(namespace, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if svc.Status.ComputedReplicas != nil && *svc.Status.ComputedReplicas >= int(scale) {
+			return nil
+		}
+
+		patch, err := scalePatch(svc.ResourceVersion, "computedReplicas", scale)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Activating service %s/%s to scale %v", namespace, name, scale)
+		_, err = h.services.Patch(namespace, name, types.MergePatchType, patch, "status")
+		return err
+	})
+}
+
+// raiseRecommendation raises the desired scale of the ServiceScaleRecommendation of a service. It returns false if the
+// service has none, which is the case for services that are not autoscaled
+func (h Handler) raiseRecommendation(namespace, name string, scale int32) (bool, error) {
+	found := true
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ssr, err := h.ssrs.Get(namespace, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			found = false
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if ssr.Status.DesiredScale != nil && *ssr.Status.DesiredScale >= scale {
+			return nil
+		}
+
+		patch, err := scalePatch(ssr.ResourceVersion, "desiredScale", scale)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Activating service %s/%s to scale %v", namespace, name, scale)
+		_, err = h.ssrs.Patch(namespace, name, types.MergePatchType, patch, "status")
+		return err
+	})
+	return found, err
+}
+
+// scalePatch returns a merge patch setting a status field to scale. The resource version makes the patch fail with a
+// conflict if the object changed since it was read
+func scalePatch(resourceVersion, field string, scale int32) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": resourceVersion,
+		},
+		"status": map[string]interface{}{
+			field: scale,
+		},
+	})
+}
@@ -1,96 +1,195 @@
 package gatewayserver
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/rancher/rio/modules/service/controllers/service/populate/serviceports"
-
 	"github.com/rancher/rio-autoscaler/pkg/controllers/servicescale"
+	autoscalev1controller "github.com/rancher/rio-autoscaler/pkg/generated/controllers/autoscale.rio.cattle.io/v1"
+	"github.com/rancher/rio-autoscaler/pkg/metricsource"
 	"github.com/rancher/rio-autoscaler/types"
 	riov1controller "github.com/rancher/rio/pkg/generated/controllers/rio.cattle.io/v1"
 	"github.com/rancher/rio/pkg/services"
 	name2 "github.com/rancher/wrangler/pkg/name"
 	"github.com/sirupsen/logrus"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/apimachinery/pkg/util/proxy"
 )
 
+// RioNameHeader and RioNamespaceHeader select the target service of a request, requests without them are routed by Host
 const (
 	RioNameHeader      = "X-Rio-ServiceName"
 	RioNamespaceHeader = "X-Rio-Namespace"
 )
 
-func NewHandler(rContext *types.Context, lock *sync.RWMutex, autoscalers map[string]*servicescale.SimpleScale) Handler {
-	return Handler{
-		services:    rContext.Rio.Rio().V1().Service(),
-		lock:        lock,
-		autoscalers: autoscalers,
+// Options configure the gateway Handler
+type Options struct {
+	// ActivationTimeout is how long a request is held for a service that has no ready endpoints
+	ActivationTimeout time.Duration
+	// ActivationScale is the scale a service is raised to at least when it is activated
+	ActivationScale int
+	// MaxServiceRequests and MaxRequests limit the requests held per service and in total, 0 means unlimited
+	MaxServiceRequests int
+	MaxRequests        int
+	// MaxServiceQueue limits the requests waiting for a service to become ready, 0 means unlimited
+	MaxServiceQueue int
+	// RetryAfter is sent to clients whose requests are rejected
+	RetryAfter time.Duration
+	// BackendCAFile holds the CAs backends served over https are verified against, the system roots if empty
+	BackendCAFile string
+}
+
+func NewHandler(ctx context.Context, rContext *types.Context, lock *sync.RWMutex, autoscalers map[string]*servicescale.SimpleScale, requests *metricsource.GatewayRequests, opts Options) (Handler, error) {
+	backendTransport, err := newBackendTransport(opts.BackendCAFile)
+	if err != nil {
+		return Handler{}, err
 	}
+
+	return Handler{
+		services:         rContext.Rio.Rio().V1().Service(),
+		ssrs:             rContext.Autoscale.Autoscale().V1().ServiceScaleRecommendation(),
+		serviceCache:     rContext.Rio.Rio().V1().Service().Cache(),
+		resolver:         newResolver(rContext),
+		activator:        newActivator(ctx, rContext.Core.Core().V1().Endpoints(), opts.MaxServiceQueue),
+		limiter:          newLimiter(opts.MaxServiceRequests, opts.MaxRequests),
+		requests:         requests,
+		opts:             opts,
+		lock:             lock,
+		autoscalers:      autoscalers,
+		backendTransport: backendTransport,
+	}, nil
 }
 
 type Handler struct {
-	services    riov1controller.ServiceController
-	autoscalers map[string]*servicescale.SimpleScale
-	lock        *sync.RWMutex
+	services     riov1controller.ServiceController
+	ssrs         autoscalev1controller.ServiceScaleRecommendationController
+	serviceCache riov1controller.ServiceCache
+	resolver     *resolver
+	activator    *activator
+	limiter      *limiter
+	requests     *metricsource.GatewayRequests
+	opts         Options
+	autoscalers  map[string]*servicescale.SimpleScale
+	lock         *sync.RWMutex
+
+	backendTransport http.RoundTripper
 }
 
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
-	name := r.Header.Get(RioNameHeader)
-	namespace := r.Header.Get(RioNamespaceHeader)
-
-	svc, err := h.services.Get(namespace, name, metav1.GetOptions{})
-	if err != nil {
+	svc, err := h.resolver.resolve(r)
+	if isNotFound(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
+	namespace, name := svc.Namespace, svc.Name
 
-	svc.Status.ComputedReplicas = &[]int{1}[0]
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if ok, status := h.limiter.acquire(key); !ok {
+		h.reject(w, status, fmt.Sprintf("too many requests for service %s", key))
+		return
+	}
+	defer h.limiter.release(key)
 
-	h.lock.Lock()
-	sc, ok := h.autoscalers[fmt.Sprintf("%s/%s", namespace, name)]
-	if ok {
-		sc.ReportMetric()
+	port, err := selectPort(svc, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	protocol, err := backendProtocol(svc, port, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
 	}
-	h.lock.Unlock()
 
-	logrus.Infof("Activating service %s to scale 1", svc.Name)
-	if _, err := h.services.UpdateStatus(svc); err != nil {
+	app, version := services.AppAndVersion(svc)
+	target := name2.SafeConcatName(app, version)
+	if err := h.activator.activate(namespace, target, h.opts.ActivationTimeout, func() error {
+		return h.scaleUp(namespace, name)
+	}); err != nil {
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	checkPort := ""
-	for _, port := range serviceports.ContainerPorts(svc) {
-		if port.IsExposed() && port.IsHTTP() {
-			checkPort = strconv.Itoa(int(port.Port))
-			continue
-		}
+	dequeue := h.requests.Queue(key)
+	err = h.activator.wait(r.Context(), namespace, target, h.opts.ActivationTimeout)
+	dequeue()
+	if err == errQueueFull {
+		h.reject(w, http.StatusTooManyRequests, err.Error())
+		return
+	} else if err != nil {
+		logrus.Warnf("activating service %s/%s failed: %v", svc.Namespace, svc.Name, err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
 	}
-
-	app, version := services.AppAndVersion(svc)
-	serveFQDN(name2.SafeConcatName(app, version), namespace, checkPort, w, r)
+	// upgraded connections such as WebSockets stay open for long, they are counted apart from requests
+	count := h.requests.InFlight
+	if httpstream.IsUpgradeRequest(r) {
+		count = h.requests.Connection
+	}
+	done := count(key)
+	h.serveFQDN(target, namespace, strconv.Itoa(int(port.Port)), protocol, w, r)
+	done()
 
 	logrus.Infof("activating service %s/%s takes %v seconds", svc.Name, svc.Namespace, time.Since(start).Seconds())
 }
 
-func serveFQDN(name, namespace, port string, w http.ResponseWriter, r *http.Request) {
+func (h Handler) reject(w http.ResponseWriter, status int, msg string) {
+	if h.opts.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(h.opts.RetryAfter.Seconds()))))
+	}
+	http.Error(w, msg, status)
+}
+
+// serveFQDN proxies r to port of the kubernetes service name in namespace. With h2c the request is proxied over
+// HTTP/2 without TLS and the response is flushed as it arrives, so gRPC streams and trailers pass through. With https
+// the backend is verified against the backend CA of the gateway
+func (h Handler) serveFQDN(name, namespace, port, protocol string, w http.ResponseWriter, r *http.Request) {
 	targetURL := &url.URL{
-		Scheme: "http",
-		Host:   fmt.Sprintf("%s.%s.svc:%s", name, namespace, port),
-		Path:   r.URL.Path,
+		Scheme:   "http",
+		Host:     fmt.Sprintf("%s.%s.svc:%s", name, namespace, port),
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+	}
+
+	if protocol == protocolH2C {
+		httpProxy := &httputil.ReverseProxy{
+			Director: func(req *http.Request) {
+				req.URL.Scheme = targetURL.Scheme
+				req.URL.Host = targetURL.Host
+				req.Host = targetURL.Host
+			},
+			Transport:     http2Transport,
+			FlushInterval: -1,
+			ErrorHandler:  er.Error,
+		}
+		httpProxy.ServeHTTP(w, r)
+		return
 	}
+
+	transport := http.DefaultTransport
+	if protocol == protocolHTTPS {
+		targetURL.Scheme = "https"
+		transport = h.backendTransport
+	}
+
 	r.URL = targetURL
 	r.URL.Host = targetURL.Host
 	r.Host = targetURL.Host
 
-	httpProxy := proxy.NewUpgradeAwareHandler(targetURL, autoTransport, true, false, er)
+	httpProxy := proxy.NewUpgradeAwareHandler(targetURL, transport, true, false, er)
 	httpProxy.ServeHTTP(w, r)
 }
 
@@ -99,9 +198,45 @@ var er = &errorResponder{}
 type errorResponder struct {
 }
 
+// Error answers gRPC requests with the UNAVAILABLE status, which gRPC clients understand and may retry, and other
+// requests with a 500
 func (e *errorResponder) Error(w http.ResponseWriter, req *http.Request, err error) {
+	if isGRPC(req) {
+		grpcError(w, grpcUnavailable, err.Error())
+		return
+	}
 	w.WriteHeader(http.StatusInternalServerError)
 	if _, err := w.Write([]byte(err.Error())); err != nil {
 		logrus.Errorf("error writing response: %v", err)
 	}
 }
+
+// grpcUnavailable is the gRPC status code UNAVAILABLE
+const grpcUnavailable = 14
+
+func isGRPC(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+// grpcError writes a trailers-only gRPC response with status code and message. gRPC responses are always 200, the
+// status is carried in the grpc-status header
+func grpcError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", grpcMessageEncode(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcMessageEncode percent-encodes message as the gRPC protocol requires for grpc-message
+func grpcMessageEncode(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,318 @@
+package gatewayserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rancher/rio-autoscaler/pkg/metricsource"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// StatsPath is where replicas running autoscalers accept the statistics forwarded by the gateways of other replicas
+const StatsPath = "/v1/gateway-stats"
+
+type statsReport struct {
+	Replica string                                `json:"replica"`
+	Counts  map[string]metricsource.GatewayCounts `json:"counts"`
+}
+
+// StatsHandler accepts the statistics forwarded by the gateways of other replicas. They are counted for ttl, so the
+// statistics of a replica that stopped forwarding expire. A report is only accepted from the pod IP of the replica it
+// names, which must be a current pod in namespace running with the service account of this replica
+func StatsHandler(k8s kubernetes.Interface, namespace string, requests *metricsource.GatewayRequests, ttl time.Duration) (http.Handler, error) {
+	if namespace == "" {
+		namespace = "kube-system"
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	senders := &statsSenders{
+		k8s:       k8s,
+		namespace: namespace,
+		identity:  identity,
+		ttl:       ttl,
+		verified:  map[string]time.Time{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(StatsPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var report statsReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if report.Replica == "" {
+			http.Error(w, "report has no replica", http.StatusBadRequest)
+			return
+		}
+		if err := senders.verify(report.Replica, r.RemoteAddr); err != nil {
+			logrus.Warnf("Rejected gateway stats of %s from %s: %v", report.Replica, r.RemoteAddr, err)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		requests.SetRemote(report.Replica, report.Counts, ttl)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux, nil
+}
+
+// statsSenders verifies that reports come from replicas of the autoscaler. Verified senders are remembered for ttl
+type statsSenders struct {
+	k8s       kubernetes.Interface
+	namespace string
+	identity  string
+	ttl       time.Duration
+
+	lock           sync.Mutex
+	serviceAccount string
+	verified       map[string]time.Time
+}
+
+// verify returns an error unless replica is a pod in the namespace of this replica that is not terminating, runs with
+// the same service account and has the IP the report was sent from
+func (s *statsSenders) verify(replica, remoteAddr string) error {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return err
+	}
+	key := replica + "/" + ip
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if verified, ok := s.verified[key]; ok && time.Since(verified) < s.ttl {
+		return nil
+	}
+	delete(s.verified, key)
+
+	if s.serviceAccount == "" {
+		self, err := s.k8s.CoreV1().Pods(s.namespace).Get(s.identity, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("reading pod of this replica: %v", err)
+		}
+		s.serviceAccount = self.Spec.ServiceAccountName
+	}
+
+	pod, err := s.k8s.CoreV1().Pods(s.namespace).Get(replica, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	switch {
+	case pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning:
+		return fmt.Errorf("pod %s/%s is not running", s.namespace, replica)
+	case pod.Spec.ServiceAccountName != s.serviceAccount:
+		return fmt.Errorf("pod %s/%s does not run as service account %s", s.namespace, replica, s.serviceAccount)
+	case pod.Status.PodIP != ip:
+		return fmt.Errorf("pod %s/%s has IP %s", s.namespace, replica, pod.Status.PodIP)
+	}
+
+	now := time.Now()
+	for k, verified := range s.verified {
+		if now.Sub(verified) >= s.ttl {
+			delete(s.verified, k)
+		}
+	}
+	s.verified[key] = now
+	return nil
+}
+
+// Owners tells which replica runs the autoscaler of a service
+type Owners interface {
+	// Owner returns the identity of the replica running the autoscaler of the service key, "" if none does
+	Owner(key string) string
+}
+
+// LeaderOwners are the Owners when the leader runs every autoscaler. The leader is read from the leader election lock
+// and cached for ttl
+type LeaderOwners struct {
+	lock     sync.Mutex
+	election resourcelock.Interface
+	ttl      time.Duration
+	leader   string
+	read     time.Time
+}
+
+// NewLeaderOwners returns the LeaderOwners of the leader election lock name in namespace
+func NewLeaderOwners(k8s kubernetes.Interface, namespace, name string, ttl time.Duration) (*LeaderOwners, error) {
+	if namespace == "" {
+		namespace = "kube-system"
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	election, err := resourcelock.New(resourcelock.ConfigMapsResourceLock, namespace, name, k8s.CoreV1(), k8s.CoordinationV1(), resourcelock.ResourceLockConfig{
+		Identity: identity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &LeaderOwners{
+		election: election,
+		ttl:      ttl,
+	}, nil
+}
+
+func (l *LeaderOwners) Owner(key string) string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if time.Since(l.read) >= l.ttl {
+		record, err := l.election.Get()
+		if err != nil {
+			logrus.Debugf("Failed to read autoscaler leader: %v", err)
+			return l.leader
+		}
+		l.leader = record.HolderIdentity
+		l.read = time.Now()
+	}
+	return l.leader
+}
+
+// StatsForwarder sends the statistics of the gateway of this replica to the replicas running the autoscalers of the
+// services. Statistics of services autoscaled by this replica are not forwarded, its autoscalers read them directly
+type StatsForwarder struct {
+	k8s       kubernetes.Interface
+	namespace string
+	owners    Owners
+	identity  string
+	port      string
+	interval  time.Duration
+	requests  *metricsource.GatewayRequests
+	client    *http.Client
+
+	addresses map[string]string
+	// sent are the replicas forwarded to last time, they are sent an empty report once this replica holds no more
+	// requests for their services
+	sent map[string]bool
+}
+
+// NewStatsForwarder returns a StatsForwarder sending to statsAddr of the owners of services every interval. The
+// replicas are pods in namespace named after their identity, which is their hostname
+func NewStatsForwarder(k8s kubernetes.Interface, namespace string, owners Owners, statsAddr string, interval time.Duration, requests *metricsource.GatewayRequests) (*StatsForwarder, error) {
+	if namespace == "" {
+		namespace = "kube-system"
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	_, port, err := net.SplitHostPort(statsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsForwarder{
+		k8s:       k8s,
+		namespace: namespace,
+		owners:    owners,
+		identity:  identity,
+		port:      port,
+		interval:  interval,
+		requests:  requests,
+		client: &http.Client{
+			Timeout: interval,
+		},
+		addresses: map[string]string{},
+		sent:      map[string]bool{},
+	}, nil
+}
+
+func (f *StatsForwarder) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.forward()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *StatsForwarder) forward() {
+	reports := map[string]map[string]metricsource.GatewayCounts{}
+	for owner := range f.sent {
+		reports[owner] = map[string]metricsource.GatewayCounts{}
+	}
+	for key, counts := range f.requests.Local() {
+		owner := f.owners.Owner(key)
+		if owner == "" || owner == f.identity {
+			continue
+		}
+		if reports[owner] == nil {
+			reports[owner] = map[string]metricsource.GatewayCounts{}
+		}
+		reports[owner][key] = counts
+	}
+
+	sent := map[string]bool{}
+	for owner, counts := range reports {
+		if err := f.send(owner, counts); err != nil {
+			logrus.Debugf("Failed to forward gateway stats to %s: %v", owner, err)
+			delete(f.addresses, owner)
+			continue
+		}
+		if len(counts) > 0 {
+			sent[owner] = true
+		}
+	}
+	f.sent = sent
+}
+
+func (f *StatsForwarder) send(owner string, counts map[string]metricsource.GatewayCounts) error {
+	addr, err := f.address(owner)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(statsReport{
+		Replica: f.identity,
+		Counts:  counts,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Post(fmt.Sprintf("http://%s%s", addr, StatsPath), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("%s returned %s", owner, resp.Status)
+	}
+	return nil
+}
+
+// address returns the address of the stats endpoint of the replica owner, the name of whose pod is its identity
+func (f *StatsForwarder) address(owner string) (string, error) {
+	if addr, ok := f.addresses[owner]; ok {
+		return addr, nil
+	}
+	pod, err := f.k8s.CoreV1().Pods(f.namespace).Get(owner, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if pod.Status.PodIP == "" {
+		return "", fmt.Errorf("pod %s/%s has no IP", f.namespace, owner)
+	}
+	f.addresses[owner] = net.JoinHostPort(pod.Status.PodIP, f.port)
+	return f.addresses[owner], nil
+}
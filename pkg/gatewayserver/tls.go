@@ -0,0 +1,168 @@
+package gatewayserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TLSOptions configure TLS serving of the gateway
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile makes the gateway require client certificates signed by one of its CAs
+	ClientCAFile string
+	// ReloadInterval is how often the files are checked for rotated certificates
+	ReloadInterval time.Duration
+}
+
+// NewTLSConfig returns the TLS config of the gateway server. The certificate, key and client CAs are reloaded from their
+// files whenever they change, so rotated certificates are served without a restart
+func NewTLSConfig(ctx context.Context, opts TLSOptions) (*tls.Config, error) {
+	r := &certReloader{
+		opts: opts,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	if opts.ReloadInterval > 0 {
+		go r.watch(ctx)
+	}
+
+	return &tls.Config{
+		GetCertificate:     r.certificate,
+		GetConfigForClient: r.configForClient,
+	}, nil
+}
+
+type certReloader struct {
+	lock      sync.RWMutex
+	opts      TLSOptions
+	contents  [][]byte
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func (r *certReloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{*r.cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if r.clientCAs != nil {
+		config.ClientCAs = r.clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func (r *certReloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.reload(); err != nil {
+				logrus.Errorf("Failed to reload gateway certificates, keep serving the previous ones: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload reads the files of the certificate, key and client CAs and swaps them in if any of them changed
+func (r *certReloader) reload() error {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		contents[i] = content
+	}
+
+	r.lock.RLock()
+	unchanged := equalContents(r.contents, contents)
+	r.lock.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(contents[2]) {
+			return fmt.Errorf("no certificates found in %s", r.opts.ClientCAFile)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.contents != nil {
+		logrus.Infof("Reloaded gateway certificate from %s", r.opts.CertFile)
+	}
+	r.contents = contents
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	return nil
+}
+
+func equalContents(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// newBackendTransport returns the transport used for backends served over https. The backend certificates are
+// verified against the CAs in caFile, or the system roots if it is empty
+func newBackendTransport(caFile string) (http.RoundTripper, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		content, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return transport, nil
+}
@@ -0,0 +1,82 @@
+package metricsource
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rancher/rio-autoscaler/pkg/prometheus"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const envoyMetricsPort = 15090
+
+// envoySource reads in-flight requests from the inbound clusters of the envoy sidecar admin stats
+type envoySource struct {
+	target Target
+	client *http.Client
+}
+
+func (e *envoySource) Collect(pods []*corev1.Pod) (Observation, error) {
+	var active, upgrades float64
+	requestCounts := map[string]float64{}
+	podConnections := map[string]int{}
+	latencyBuckets := map[string]prometheus.Buckets{}
+	results := scrapePods(e.client, pods, func(pod *corev1.Pod) string {
+		return fmt.Sprintf("http://%s:%d/stats/prometheus", pod.Status.PodIP, envoyMetricsPort)
+	})
+	errs, err := scrapeErrors(results)
+	if err != nil {
+		return Observation{}, err
+	}
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		pod, samples := result.pod, result.samples
+		for _, sample := range samples {
+			// upgraded streams stay active in the inbound cluster for as long as the connection is open
+			if sample.Name == "envoy_http_downstream_cx_upgrades_active" && inboundConnectionManager(sample) {
+				upgrades += sample.Value
+				podConnections[pod.Name] += int(sample.Value)
+				continue
+			}
+			if !strings.HasPrefix(sample.Labels["cluster_name"], "inbound|") {
+				continue
+			}
+			switch sample.Name {
+			case "envoy_cluster_upstream_rq_active":
+				active += sample.Value
+			case "envoy_cluster_upstream_rq_total":
+				requestCounts[pod.Name] += sample.Value
+			}
+		}
+		latencyBuckets[pod.Name] = prometheus.HistogramBuckets(samples, "envoy_cluster_upstream_rq_time_bucket", func(sample prometheus.Sample) bool {
+			return strings.HasPrefix(sample.Labels["cluster_name"], "inbound|")
+		})
+	}
+
+	active -= upgrades
+	if active < 0 {
+		active = 0
+	}
+
+	logrus.Debugf("envoy in-flight requests for %s/%s-%s: %v, upgraded connections: %v", e.target.Namespace, e.target.App, e.target.Version, active, upgrades)
+	return Observation{
+		ActiveRequests: int(active),
+		RequestCounts:  requestCounts,
+		LatencyBuckets: latencyBuckets,
+		Connections:    int(upgrades),
+		PodConnections: podConnections,
+		ScrapeErrors:   errs,
+	}, nil
+}
+
+func inboundConnectionManager(sample prometheus.Sample) bool {
+	prefix := sample.Labels["http_conn_manager_prefix"]
+	if prefix == "" {
+		prefix = sample.Labels["envoy_http_conn_manager_prefix"]
+	}
+	return strings.HasPrefix(prefix, "inbound")
+}
@@ -0,0 +1,194 @@
+package metricsource
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// GatewayRequests counts the requests the gateway holds for each service, keyed by namespace/name. Requests are either
+// queued waiting for the service to become ready, in flight to its pods, or upgraded connections such as WebSockets.
+// The gateways of other replicas forward their counts to the leader, which adds them to its own
+type GatewayRequests struct {
+	lock        sync.Mutex
+	inFlight    map[string]int
+	queued      map[string]int
+	connections map[string]int
+	// remote are the counts forwarded by the gateways of other replicas, keyed by replica
+	remote map[string]remoteCounts
+}
+
+// GatewayCounts are the requests the gateway holds for one service
+type GatewayCounts struct {
+	InFlight    int `json:"inFlight,omitempty"`
+	Queued      int `json:"queued,omitempty"`
+	Connections int `json:"connections,omitempty"`
+}
+
+type remoteCounts struct {
+	expires time.Time
+	counts  map[string]GatewayCounts
+}
+
+func NewGatewayRequests() *GatewayRequests {
+	return &GatewayRequests{
+		inFlight:    map[string]int{},
+		queued:      map[string]int{},
+		connections: map[string]int{},
+		remote:      map[string]remoteCounts{},
+	}
+}
+
+// Queue counts a request waiting for the service key to become ready until the returned func is called
+func (g *GatewayRequests) Queue(key string) func() {
+	return g.add(g.queued, key)
+}
+
+// InFlight counts a request being proxied to the service key until the returned func is called
+func (g *GatewayRequests) InFlight(key string) func() {
+	return g.add(g.inFlight, key)
+}
+
+// Connection counts an upgraded connection to the service key until the returned func is called
+func (g *GatewayRequests) Connection(key string) func() {
+	return g.add(g.connections, key)
+}
+
+func (g *GatewayRequests) add(counts map[string]int, key string) func() {
+	g.lock.Lock()
+	counts[key]++
+	g.lock.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.lock.Lock()
+			defer g.lock.Unlock()
+			counts[key]--
+			if counts[key] <= 0 {
+				delete(counts, key)
+			}
+		})
+	}
+}
+
+// Get returns the requests the gateway of this replica and the gateways of other replicas hold for the service key
+func (g *GatewayRequests) Get(key string) GatewayCounts {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	result := GatewayCounts{
+		InFlight:    g.inFlight[key],
+		Queued:      g.queued[key],
+		Connections: g.connections[key],
+	}
+	now := time.Now()
+	for _, remote := range g.remote {
+		if now.After(remote.expires) {
+			continue
+		}
+		counts := remote.counts[key]
+		result.InFlight += counts.InFlight
+		result.Queued += counts.Queued
+		result.Connections += counts.Connections
+	}
+	return result
+}
+
+// Local returns the requests the gateway of this replica holds for every service with any
+func (g *GatewayRequests) Local() map[string]GatewayCounts {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	result := map[string]GatewayCounts{}
+	for key, n := range g.inFlight {
+		counts := result[key]
+		counts.InFlight = n
+		result[key] = counts
+	}
+	for key, n := range g.queued {
+		counts := result[key]
+		counts.Queued = n
+		result[key] = counts
+	}
+	for key, n := range g.connections {
+		counts := result[key]
+		counts.Connections = n
+		result[key] = counts
+	}
+	return result
+}
+
+// SetRemote replaces the counts forwarded by the gateway of replica. They are counted by Get until ttl has passed
+func (g *GatewayRequests) SetRemote(replica string, counts map[string]GatewayCounts, ttl time.Duration) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	now := time.Now()
+	for r, remote := range g.remote {
+		if now.After(remote.expires) {
+			delete(g.remote, r)
+		}
+	}
+	g.remote[replica] = remoteCounts{
+		expires: now.Add(ttl),
+		counts:  counts,
+	}
+}
+
+// WithGateway returns a MetricSource that adds the requests the gateway holds for target to the observations of source.
+// Requests the gateway proxies are also seen by the pods, so the larger of the two in-flight counts is used, while
+// queued requests have not reached any pod yet and are always added. Connections upgraded through the gateway look like
+// requests that never finish to sources that cannot observe connections, so they are moved from the in-flight requests
+// to the connections of those sources. If source fails while the gateway holds requests the gateway counts are used
+// alone, so a cold start burst is not lost to pods that are not serving metrics yet
+func WithGateway(source MetricSource, requests *GatewayRequests, target Target) MetricSource {
+	return &gatewaySource{
+		source:   source,
+		requests: requests,
+		key:      fmt.Sprintf("%s/%s", target.Namespace, target.Service),
+	}
+}
+
+type gatewaySource struct {
+	source   MetricSource
+	requests *GatewayRequests
+	key      string
+}
+
+func (g *gatewaySource) Collect(pods []*corev1.Pod) (Observation, error) {
+	counts := g.requests.Get(g.key)
+
+	observation, err := g.source.Collect(pods)
+	if err != nil {
+		if counts.InFlight+counts.Queued+counts.Connections == 0 {
+			return observation, err
+		}
+		logrus.Warnf("Failed to collect metrics for %s, using gateway requests only: %v", g.key, err)
+		observation = Observation{
+			ScrapeErrors: map[string]error{},
+		}
+		for _, pod := range pods {
+			observation.ScrapeErrors[pod.Name] = err
+		}
+	}
+
+	if observation.PodConnections == nil {
+		observation.ActiveRequests -= counts.Connections
+		if observation.ActiveRequests < 0 {
+			observation.ActiveRequests = 0
+		}
+	}
+	if counts.Connections > observation.Connections {
+		observation.Connections = counts.Connections
+	}
+	if counts.InFlight > observation.ActiveRequests {
+		observation.ActiveRequests = counts.InFlight
+	}
+	observation.ActiveRequests += counts.Queued
+	logrus.Debugf("gateway requests for %s: in flight %v, queued %v, connections %v", g.key, counts.InFlight, counts.Queued, counts.Connections)
+	return observation, nil
+}
@@ -0,0 +1,92 @@
+package metricsource
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/rancher/rio-autoscaler/pkg/prometheus"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const linkerdMetricsPort = 4191
+
+// linkerdSource reads in-flight requests from the request_total and response_total counters of the linkerd proxy
+type linkerdSource struct {
+	target Target
+	client *http.Client
+}
+
+func (l *linkerdSource) Collect(pods []*corev1.Pod) (Observation, error) {
+	var inbound, outbound int
+	requestCounts := map[string]float64{}
+	latencyBuckets := map[string]prometheus.Buckets{}
+	authority := fmt.Sprintf("%s-%s.%s.svc.cluster.local", l.target.App, l.target.Version, l.target.Namespace)
+
+	results := scrapePods(l.client, pods, func(pod *corev1.Pod) string {
+		return fmt.Sprintf("http://%s:%d/metrics", pod.Status.PodIP, linkerdMetricsPort)
+	})
+	errs, err := scrapeErrors(results)
+	if err != nil {
+		return Observation{}, err
+	}
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		pod, samples := result.pod, result.samples
+		inbound += calculateActiveRequests(samples, authority, "inbound")
+		outbound += calculateActiveRequests(samples, authority, "outbound")
+		requestCounts[pod.Name] = countRequests(samples, authority, "inbound")
+		latencyBuckets[pod.Name] = prometheus.HistogramBuckets(samples, "response_latency_ms_bucket", func(sample prometheus.Sample) bool {
+			return sample.Labels["direction"] == "inbound" && matchAuthority(sample.Labels["authority"], authority)
+		})
+	}
+
+	logrus.Debugf("linkerd in-flight requests for %s: inbound %v, outbound %v", authority, inbound, outbound)
+	return Observation{
+		ActiveRequests: inbound + outbound,
+		RequestCounts:  requestCounts,
+		LatencyBuckets: latencyBuckets,
+		ScrapeErrors:   errs,
+	}, nil
+}
+
+// countRequests returns the linkerd request_total of the given authority and direction
+func countRequests(samples []prometheus.Sample, authority, direction string) float64 {
+	var request float64
+	for _, sample := range samples {
+		if sample.Name == "request_total" && sample.Labels["direction"] == direction && matchAuthority(sample.Labels["authority"], authority) {
+			request += sample.Value
+		}
+	}
+	return request
+}
+
+// calculateActiveRequests returns the linkerd request_total minus response_total of the given authority and direction
+func calculateActiveRequests(samples []prometheus.Sample, authority, direction string) int {
+	var request, response float64
+	for _, sample := range samples {
+		if sample.Labels["direction"] != direction || !matchAuthority(sample.Labels["authority"], authority) {
+			continue
+		}
+		switch sample.Name {
+		case "request_total":
+			request += sample.Value
+		case "response_total":
+			response += sample.Value
+		}
+	}
+	if request-response < 0 {
+		return 0
+	}
+	return int(request - response)
+}
+
+func matchAuthority(authority, host string) bool {
+	if h, _, err := net.SplitHostPort(authority); err == nil {
+		authority = h
+	}
+	return authority == host
+}
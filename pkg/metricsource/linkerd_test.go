@@ -0,0 +1,143 @@
+package metricsource
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// proxyClient returns a client that sends every request to server, whatever its host
+func proxyClient(server *httptest.Server) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		},
+	}
+}
+
+func testPod(name, ip string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			PodIP: ip,
+		},
+	}
+}
+
+func TestLinkerdCollect(t *testing.T) {
+	metrics, err := ioutil.ReadFile("testdata/linkerd-proxy-metrics.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(metrics)
+	}))
+	defer server.Close()
+
+	source, err := New(Linkerd, Target{
+		Namespace: "default",
+		Service:   "hello",
+		App:       "hello",
+		Version:   "v0",
+	}, Options{
+		HTTPClient: proxyClient(server),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	observation, err := source.Collect([]*corev1.Pod{testPod("hello-v0-5d9c8b7f4-x2kq9", "10.42.0.15")})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	// inbound 1042 requests and 1038 responses, outbound to the service itself 5 requests and 3 responses
+	if observation.ActiveRequests != 6 {
+		t.Errorf("ActiveRequests = %v, want 6", observation.ActiveRequests)
+	}
+	if want := map[string]float64{"hello-v0-5d9c8b7f4-x2kq9": 1042}; !reflect.DeepEqual(observation.RequestCounts, want) {
+		t.Errorf("RequestCounts = %v, want %v", observation.RequestCounts, want)
+	}
+	if len(observation.ScrapeErrors) != 0 {
+		t.Errorf("ScrapeErrors = %v, want none", observation.ScrapeErrors)
+	}
+
+	buckets := observation.LatencyBuckets["hello-v0-5d9c8b7f4-x2kq9"]
+	for le, want := range map[float64]float64{1: 2, 5: 323, 20: 958, 100: 1038} {
+		if buckets[le] != want {
+			t.Errorf("LatencyBuckets[%v] = %v, want %v", le, buckets[le], want)
+		}
+	}
+	if total := buckets[math.Inf(1)]; total != 1038 {
+		t.Errorf("LatencyBuckets[+Inf] = %v, want 1038", total)
+	}
+	if q := buckets.Quantile(0.5); q <= 5 || q > 10 {
+		t.Errorf("median latency = %v, want between 5 and 10", q)
+	}
+}
+
+func TestLinkerdCollectFailedPod(t *testing.T) {
+	metrics, err := ioutil.ReadFile("testdata/linkerd-proxy-metrics.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.Host)
+		if host == "10.42.0.16" {
+			http.Error(w, "proxy not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(metrics)
+	}))
+	defer server.Close()
+
+	source, err := New(Linkerd, Target{
+		Namespace: "default",
+		Service:   "hello",
+		App:       "hello",
+		Version:   "v0",
+	}, Options{
+		HTTPClient: proxyClient(server),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	observation, err := source.Collect([]*corev1.Pod{
+		testPod("hello-v0-5d9c8b7f4-x2kq9", "10.42.0.15"),
+		testPod("hello-v0-5d9c8b7f4-p7zrw", "10.42.0.16"),
+	})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if observation.ActiveRequests != 6 {
+		t.Errorf("ActiveRequests = %v, want 6", observation.ActiveRequests)
+	}
+	if _, ok := observation.ScrapeErrors["hello-v0-5d9c8b7f4-p7zrw"]; !ok || len(observation.ScrapeErrors) != 1 {
+		t.Errorf("ScrapeErrors = %v, want only hello-v0-5d9c8b7f4-p7zrw", observation.ScrapeErrors)
+	}
+	if _, ok := observation.RequestCounts["hello-v0-5d9c8b7f4-p7zrw"]; ok {
+		t.Errorf("RequestCounts = %v, want no counts of the failed pod", observation.RequestCounts)
+	}
+
+	if _, err := source.Collect([]*corev1.Pod{testPod("hello-v0-5d9c8b7f4-p7zrw", "10.42.0.16")}); err == nil {
+		t.Error("Collect() of only failing pods succeeded, want error")
+	}
+}
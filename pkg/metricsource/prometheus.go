@@ -0,0 +1,125 @@
+package metricsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultPrometheusQuery computes the in-flight requests of a service from the linkerd counters stored in Prometheus.
+// $namespace, $app and $version are replaced with the target of the query
+const DefaultPrometheusQuery = `sum(request_total{namespace="$namespace",app="$app",version="$version",direction="inbound"}) - sum(response_total{namespace="$namespace",app="$app",version="$version",direction="inbound"})`
+
+// PrometheusRequestQuery returns the cumulative requests served by each pod of a service, by pod
+const PrometheusRequestQuery = `sum by (pod) (request_total{namespace="$namespace",app="$app",version="$version",direction="inbound"})`
+
+// prometheusSource queries the in-flight requests of a service from a Prometheus server
+type prometheusSource struct {
+	target       Target
+	client       *http.Client
+	url          string
+	query        string
+	requestQuery string
+}
+
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func newPrometheusSource(target Target, client *http.Client, prometheusURL, query string) *prometheusSource {
+	if query == "" {
+		query = DefaultPrometheusQuery
+	}
+	replacer := strings.NewReplacer(
+		"$namespace", target.Namespace,
+		"$app", target.App,
+		"$version", target.Version,
+	)
+
+	return &prometheusSource{
+		target:       target,
+		client:       client,
+		url:          strings.TrimSuffix(prometheusURL, "/") + "/api/v1/query",
+		query:        replacer.Replace(query),
+		requestQuery: replacer.Replace(PrometheusRequestQuery),
+	}
+}
+
+func (p *prometheusSource) Collect(pods []*corev1.Pod) (Observation, error) {
+	values, err := p.instantQuery(p.query, "")
+	if err != nil {
+		return Observation{}, err
+	}
+	value := values[""]
+	if value < 0 {
+		value = 0
+	}
+
+	requestCounts, err := p.instantQuery(p.requestQuery, "pod")
+	if err != nil {
+		return Observation{}, err
+	}
+
+	logrus.Debugf("prometheus in-flight requests for %s/%s-%s: %v", p.target.Namespace, p.target.App, p.target.Version, value)
+	return Observation{
+		ActiveRequests: int(value),
+		RequestCounts:  requestCounts,
+	}, nil
+}
+
+// instantQuery runs query and returns the values of the resulting vector summed by the value of label
+func (p *prometheusSource) instantQuery(query, label string) (map[string]float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ScrapeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, strings.NewReader(url.Values{"query": []string{query}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := prometheusResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query %q failed: %s", query, result.Error)
+	}
+
+	values := map[string]float64{}
+	for _, r := range result.Data.Result {
+		if len(r.Value) != 2 {
+			continue
+		}
+		s, ok := r.Value[1].(string)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[r.Metric[label]] += v
+	}
+	return values, nil
+}
@@ -0,0 +1,105 @@
+package metricsource
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+)
+
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Containers []struct {
+			Name  string              `json:"name"`
+			Usage corev1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// ResourceMetrics reads the cpu and memory usage of pods from the metrics.k8s.io API
+type ResourceMetrics struct {
+	client rest.Interface
+}
+
+func NewResourceMetrics(client rest.Interface) *ResourceMetrics {
+	return &ResourceMetrics{
+		client: client,
+	}
+}
+
+// Utilization returns the usage of each of resourceNames by pods as a fraction of their container requests. Like the
+// HorizontalPodAutoscaler, usage and requests are summed over all pods before they are divided. Resources the pods
+// request none of are left out of the result and reported in the error, the utilization of the others is still returned
+func (r *ResourceMetrics) Utilization(namespace string, selector labels.Selector, pods []*corev1.Pod, resourceNames ...corev1.ResourceName) (map[corev1.ResourceName]float64, error) {
+	data, err := r.client.Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", namespace, "pods").
+		Param("labelSelector", selector.String()).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	list := podMetricsList{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	usage := map[string]corev1.ResourceList{}
+	for _, item := range list.Items {
+		podUsage := corev1.ResourceList{}
+		for _, c := range item.Containers {
+			for name, quantity := range c.Usage {
+				total := podUsage[name]
+				total.Add(quantity)
+				podUsage[name] = total
+			}
+		}
+		usage[item.Metadata.Name] = podUsage
+	}
+
+	result := map[corev1.ResourceName]float64{}
+	var missing []string
+	for _, resourceName := range resourceNames {
+		var used, requested int64
+		for _, pod := range pods {
+			podUsage, ok := usage[pod.Name]
+			if !ok {
+				continue
+			}
+			podRequest := podRequests(pod, resourceName)
+			if podRequest.IsZero() {
+				continue
+			}
+			podUsed := podUsage[resourceName]
+			used += podUsed.MilliValue()
+			requested += podRequest.MilliValue()
+		}
+		if requested == 0 {
+			missing = append(missing, string(resourceName))
+			continue
+		}
+		result[resourceName] = float64(used) / float64(requested)
+	}
+
+	if len(missing) > 0 {
+		return result, fmt.Errorf("no %s usage or requests found for pods in %s matching %s", strings.Join(missing, ", "), namespace, selector)
+	}
+	return result, nil
+}
+
+func podRequests(pod *corev1.Pod, resourceName corev1.ResourceName) resource.Quantity {
+	total := resource.Quantity{}
+	for _, c := range pod.Spec.Containers {
+		if request, ok := c.Resources.Requests[resourceName]; ok {
+			total.Add(request)
+		}
+	}
+	return total
+}
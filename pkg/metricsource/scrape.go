@@ -0,0 +1,115 @@
+package metricsource
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rancher/rio-autoscaler/pkg/prometheus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// ScrapeTimeout bounds scraping the metrics of one pod
+	ScrapeTimeout = 3 * time.Second
+	// ScrapeConcurrency is the most pods of one service scraped at the same time
+	ScrapeConcurrency = 10
+
+	// scrapeClient is the client of metric sources that are not given one. Its transport is not shared with other
+	// clients, so pods that hang do not hold connections needed elsewhere
+	scrapeClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   2,
+			IdleConnTimeout:       90 * time.Second,
+			ResponseHeaderTimeout: 5 * time.Second,
+		},
+	}
+)
+
+// podScrape is the result of scraping one pod
+type podScrape struct {
+	pod     *corev1.Pod
+	samples []prometheus.Sample
+	err     error
+}
+
+// scrapePods scrapes the url of every pod with at most ScrapeConcurrency requests at a time. Every pod has a result in
+// the order of pods, so a pod that fails or times out only misses its own samples
+func scrapePods(client *http.Client, pods []*corev1.Pod, url func(pod *corev1.Pod) string) []podScrape {
+	results := make([]podScrape, len(pods))
+	workers := ScrapeConcurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(pods) {
+		workers = len(pods)
+	}
+
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				samples, err := scrapePod(client, url(pods[i]))
+				results[i] = podScrape{
+					pod:     pods[i],
+					samples: samples,
+					err:     err,
+				}
+			}
+		}()
+	}
+	for i := range pods {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+func scrapePod(client *http.Client, url string) ([]prometheus.Sample, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ScrapeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scraping %s returned %s", url, resp.Status)
+	}
+	return prometheus.Parse(resp.Body)
+}
+
+// scrapeErrors returns the errors of the pods that failed in results, keyed by pod name, and an error if every pod
+// failed, in which case there is nothing to observe
+func scrapeErrors(results []podScrape) (map[string]error, error) {
+	errs := map[string]error{}
+	var last error
+	for _, result := range results {
+		if result.err != nil {
+			errs[result.pod.Name] = result.err
+			last = result.err
+		}
+	}
+	if len(results) > 0 && len(errs) == len(results) {
+		return errs, fmt.Errorf("scraping all %d pods failed, last error: %v", len(results), last)
+	}
+	return errs, nil
+}
@@ -0,0 +1,81 @@
+package metricsource
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rancher/rio-autoscaler/pkg/prometheus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	Linkerd    = "linkerd"
+	Envoy      = "envoy"
+	Prometheus = "prometheus"
+)
+
+// Target identifies the pods of a rio service a MetricSource collects metrics for
+type Target struct {
+	Namespace string
+	Service   string
+	App       string
+	Version   string
+}
+
+// Observation is what a MetricSource observed for a service in one scrape
+type Observation struct {
+	// ActiveRequests is the total number of in-flight requests across all ready pods
+	ActiveRequests int
+	// RequestCounts are the cumulative requests served by each pod, keyed by pod name
+	RequestCounts map[string]float64
+	// LatencyBuckets are the cumulative response latency histograms in milliseconds of each pod, keyed by pod name
+	LatencyBuckets map[string]prometheus.Buckets
+	// Connections is the total number of open upgraded connections such as WebSockets across all ready pods. They are
+	// long lived, so they are not counted in ActiveRequests
+	Connections int
+	// PodConnections are the open upgraded connections of each pod, keyed by pod name. It is nil if the source cannot
+	// observe connections
+	PodConnections map[string]int
+	// ScrapeErrors are the errors of the pods whose metrics could not be scraped, keyed by pod name. Those pods are left
+	// out of the rest of the observation
+	ScrapeErrors map[string]error
+}
+
+// MetricSource collects the metrics of a service that SimpleScale makes scaling decisions on
+type MetricSource interface {
+	Collect(pods []*corev1.Pod) (Observation, error)
+}
+
+// Options configure the MetricSource returned by New
+type Options struct {
+	HTTPClient      *http.Client
+	PrometheusURL   string
+	PrometheusQuery string
+}
+
+// New returns the MetricSource called name for target
+func New(name string, target Target, opts Options) (MetricSource, error) {
+	client := opts.HTTPClient
+	if client == nil {
+		client = scrapeClient
+	}
+
+	switch name {
+	case "", Linkerd:
+		return &linkerdSource{
+			target: target,
+			client: client,
+		}, nil
+	case Envoy:
+		return &envoySource{
+			target: target,
+			client: client,
+		}, nil
+	case Prometheus:
+		if opts.PrometheusURL == "" {
+			return nil, fmt.Errorf("prometheus metric source requires a prometheus url")
+		}
+		return newPrometheusSource(target, client, opts.PrometheusURL, opts.PrometheusQuery), nil
+	}
+	return nil, fmt.Errorf("unknown metric source %s", name)
+}
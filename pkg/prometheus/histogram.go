@@ -0,0 +1,61 @@
+package prometheus
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Buckets are the cumulative counts of a histogram keyed by the upper bound of each bucket
+type Buckets map[float64]float64
+
+// HistogramBuckets sums the buckets of all samples called name for which matches returns true
+func HistogramBuckets(samples []Sample, name string, matches func(Sample) bool) Buckets {
+	buckets := Buckets{}
+	for _, sample := range samples {
+		if sample.Name != name || !matches(sample) {
+			continue
+		}
+		le, err := strconv.ParseFloat(sample.Labels["le"], 64)
+		if err != nil {
+			continue
+		}
+		buckets[le] += sample.Value
+	}
+	return buckets
+}
+
+// Quantile estimates the q quantile of the histogram the same way histogram_quantile does in PromQL. It returns NaN
+// if the histogram is empty
+func (b Buckets) Quantile(q float64) float64 {
+	bounds := make([]float64, 0, len(b))
+	for le := range b {
+		bounds = append(bounds, le)
+	}
+	sort.Float64s(bounds)
+
+	if len(bounds) == 0 || !math.IsInf(bounds[len(bounds)-1], 1) {
+		return math.NaN()
+	}
+	total := b[bounds[len(bounds)-1]]
+	if total == 0 {
+		return math.NaN()
+	}
+
+	rank := q * total
+	var lower, previous float64
+	for _, upper := range bounds {
+		count := b[upper]
+		if count >= rank {
+			if math.IsInf(upper, 1) {
+				return lower
+			}
+			if count == previous {
+				return upper
+			}
+			return lower + (upper-lower)*(rank-previous)/(count-previous)
+		}
+		lower, previous = upper, count
+	}
+	return lower
+}
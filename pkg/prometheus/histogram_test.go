@@ -0,0 +1,88 @@
+package prometheus
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantile(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		name    string
+		buckets Buckets
+		q       float64
+		want    float64
+	}{
+		{
+			name:    "interpolated within a bucket",
+			buckets: Buckets{10: 20, 20: 60, 50: 100, inf: 100},
+			q:       0.5,
+			want:    17.5,
+		},
+		{
+			name:    "interpolated from zero in the first bucket",
+			buckets: Buckets{10: 40, 20: 80, inf: 80},
+			q:       0.25,
+			want:    5,
+		},
+		{
+			name:    "rank at a bucket bound",
+			buckets: Buckets{10: 50, 20: 100, inf: 100},
+			q:       0.5,
+			want:    10,
+		},
+		{
+			name:    "empty bucket below the rank",
+			buckets: Buckets{10: 50, 20: 50, 50: 100, inf: 100},
+			q:       0.5,
+			want:    10,
+		},
+		{
+			name:    "rank in the +Inf bucket returns the highest finite bound",
+			buckets: Buckets{10: 50, 100: 90, inf: 100},
+			q:       0.95,
+			want:    100,
+		},
+		{
+			name:    "only +Inf",
+			buckets: Buckets{inf: 10},
+			q:       0.5,
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.buckets.Quantile(tt.q); got != tt.want {
+				t.Errorf("Quantile(%v) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantileNaN(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets Buckets
+	}{
+		{
+			name: "no buckets",
+		},
+		{
+			name:    "no +Inf bucket",
+			buckets: Buckets{10: 5, 20: 10},
+		},
+		{
+			name:    "no observations",
+			buckets: Buckets{10: 0, math.Inf(1): 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.buckets.Quantile(0.95); !math.IsNaN(got) {
+				t.Errorf("Quantile(0.95) = %v, want NaN", got)
+			}
+		})
+	}
+}
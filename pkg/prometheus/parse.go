@@ -0,0 +1,228 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type MetricType string
+
+const (
+	Counter   = MetricType("counter")
+	Gauge     = MetricType("gauge")
+	Histogram = MetricType("histogram")
+	Summary   = MetricType("summary")
+	Untyped   = MetricType("untyped")
+)
+
+// Sample is a single sample of the Prometheus text or OpenMetrics exposition format
+type Sample struct {
+	// Name is the name of the sample, including suffixes such as _bucket or _total
+	Name string
+	// Family is the name of the metric family the sample belongs to
+	Family string
+	Type   MetricType
+	Labels map[string]string
+	Value  float64
+	// Timestamp is in milliseconds since epoch, 0 if the sample has none
+	Timestamp int64
+}
+
+// Matches returns true if the sample has the given name and all of the given labels
+func (s Sample) Matches(name string, labels map[string]string) bool {
+	if s.Name != name {
+		return false
+	}
+	for k, v := range labels {
+		if s.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+var familySuffixes = []string{"_bucket", "_count", "_sum", "_total", "_created", "_gcount", "_gsum", "_info"}
+
+// Parse reads samples in the Prometheus text exposition format or the OpenMetrics text format from r
+func Parse(r io.Reader) ([]Sample, error) {
+	var (
+		result  []Sample
+		types   = map[string]MetricType{}
+		scanner = bufio.NewScanner(r)
+		lineNo  int
+	)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[1] == "EOF" {
+				break
+			}
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = MetricType(strings.ToLower(fields[3]))
+			}
+			continue
+		}
+
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		sample.Family, sample.Type = family(sample.Name, types)
+		result = append(result, sample)
+	}
+
+	return result, scanner.Err()
+}
+
+func family(name string, types map[string]MetricType) (string, MetricType) {
+	if t, ok := types[name]; ok {
+		return name, t
+	}
+	for _, suffix := range familySuffixes {
+		if base := strings.TrimSuffix(name, suffix); base != name {
+			if t, ok := types[base]; ok {
+				return base, t
+			}
+		}
+	}
+	return name, Untyped
+}
+
+func parseSample(line string) (Sample, error) {
+	sample := Sample{
+		Labels: map[string]string{},
+	}
+
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return sample, fmt.Errorf("invalid sample %q", line)
+	}
+	sample.Name = line[:i]
+	rest := line[i:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, n, err := parseLabels(rest)
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		rest = rest[n:]
+	}
+
+	// drop OpenMetrics exemplars
+	if i := strings.Index(rest, "#"); i >= 0 {
+		rest = rest[:i]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("invalid value and timestamp %q", rest)
+	}
+
+	value, err := parseFloat(fields[0])
+	if err != nil {
+		return sample, err
+	}
+	sample.Value = value
+
+	if len(fields) == 2 {
+		ts, err := parseTimestamp(fields[1])
+		if err != nil {
+			return sample, err
+		}
+		sample.Timestamp = ts
+	}
+
+	return sample, nil
+}
+
+// parseLabels parses a label set starting with { and returns the labels and the number of bytes consumed
+func parseLabels(s string) (map[string]string, int, error) {
+	labels := map[string]string{}
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("unterminated label set %q", s)
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 {
+			return nil, 0, fmt.Errorf("invalid label set %q", s)
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) || s[i] != '"' {
+			return nil, 0, fmt.Errorf("label %s value is not quoted", name)
+		}
+		i++
+
+		var value strings.Builder
+		for ; ; i++ {
+			if i >= len(s) {
+				return nil, 0, fmt.Errorf("unterminated value of label %s", name)
+			}
+			c := s[i]
+			if c == '"' {
+				i++
+				break
+			}
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(c)
+		}
+		labels[name] = value.String()
+	}
+}
+
+func parseFloat(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "nan":
+		return math.NaN(), nil
+	case "+inf", "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseTimestamp accepts integer milliseconds of the text format and float seconds of OpenMetrics
+func parseTimestamp(s string) (int64, error) {
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ts, nil
+	}
+	ts, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return int64(ts * 1000), nil
+}
@@ -0,0 +1,287 @@
+package prometheus
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// linkerdExcerpt is an excerpt of the :4191/metrics output of linkerd2-proxy
+const linkerdExcerpt = `# HELP request_total Total count of HTTP requests.
+# TYPE request_total counter
+request_total{direction="inbound",authority="hello-v0.default.svc.cluster.local:8080",target_addr="10.42.0.15:8080",tls="true",client_id="default.default.serviceaccount.identity.linkerd.cluster.local"} 1000
+# HELP response_latency_ms Elapsed times between a request's headers being received and its response stream completing
+# TYPE response_latency_ms histogram
+response_latency_ms_bucket{direction="inbound",authority="hello-v0.default.svc.cluster.local:8080",status_code="200",le="10"} 700
+response_latency_ms_bucket{direction="inbound",authority="hello-v0.default.svc.cluster.local:8080",status_code="200",le="+Inf"} 980
+response_latency_ms_count{direction="inbound",authority="hello-v0.default.svc.cluster.local:8080",status_code="200"} 980
+# HELP process_start_time_seconds Time that the process started (in seconds since the UNIX epoch)
+# TYPE process_start_time_seconds gauge
+process_start_time_seconds 1571216381
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Sample
+	}{
+		{
+			name:  "linkerd proxy",
+			input: linkerdExcerpt,
+			want: []Sample{
+				{
+					Name:   "request_total",
+					Family: "request_total",
+					Type:   Counter,
+					Labels: map[string]string{
+						"direction":   "inbound",
+						"authority":   "hello-v0.default.svc.cluster.local:8080",
+						"target_addr": "10.42.0.15:8080",
+						"tls":         "true",
+						"client_id":   "default.default.serviceaccount.identity.linkerd.cluster.local",
+					},
+					Value: 1000,
+				},
+				{
+					Name:   "response_latency_ms_bucket",
+					Family: "response_latency_ms",
+					Type:   Histogram,
+					Labels: map[string]string{
+						"direction":   "inbound",
+						"authority":   "hello-v0.default.svc.cluster.local:8080",
+						"status_code": "200",
+						"le":          "10",
+					},
+					Value: 700,
+				},
+				{
+					Name:   "response_latency_ms_bucket",
+					Family: "response_latency_ms",
+					Type:   Histogram,
+					Labels: map[string]string{
+						"direction":   "inbound",
+						"authority":   "hello-v0.default.svc.cluster.local:8080",
+						"status_code": "200",
+						"le":          "+Inf",
+					},
+					Value: 980,
+				},
+				{
+					Name:   "response_latency_ms_count",
+					Family: "response_latency_ms",
+					Type:   Histogram,
+					Labels: map[string]string{
+						"direction":   "inbound",
+						"authority":   "hello-v0.default.svc.cluster.local:8080",
+						"status_code": "200",
+					},
+					Value: 980,
+				},
+				{
+					Name:   "process_start_time_seconds",
+					Family: "process_start_time_seconds",
+					Type:   Gauge,
+					Labels: map[string]string{},
+					Value:  1571216381,
+				},
+			},
+		},
+		{
+			name: "histogram sum and untyped",
+			input: `# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_sum{code="200"} 53423.5
+other_metric 3
+`,
+			want: []Sample{
+				{
+					Name:   "http_request_duration_seconds_sum",
+					Family: "http_request_duration_seconds",
+					Type:   Histogram,
+					Labels: map[string]string{"code": "200"},
+					Value:  53423.5,
+				},
+				{
+					Name:   "other_metric",
+					Family: "other_metric",
+					Type:   Untyped,
+					Labels: map[string]string{},
+					Value:  3,
+				},
+			},
+		},
+		{
+			name:  "label escapes",
+			input: `msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\"",empty=""} 1.458255915e9` + "\n",
+			want: []Sample{
+				{
+					Name:   "msdos_file_access_time_seconds",
+					Family: "msdos_file_access_time_seconds",
+					Type:   Untyped,
+					Labels: map[string]string{
+						"path":  `C:\DIR\FILE.TXT`,
+						"error": "Cannot find file:\n\"FILE.TXT\"",
+						"empty": "",
+					},
+					Value: 1.458255915e9,
+				},
+			},
+		},
+		{
+			name: "timestamps",
+			input: `text_format{a="b"} 1 1395066363000
+openmetrics_format{a="b"} 2 1395066363.5
+`,
+			want: []Sample{
+				{
+					Name:      "text_format",
+					Family:    "text_format",
+					Type:      Untyped,
+					Labels:    map[string]string{"a": "b"},
+					Value:     1,
+					Timestamp: 1395066363000,
+				},
+				{
+					Name:      "openmetrics_format",
+					Family:    "openmetrics_format",
+					Type:      Untyped,
+					Labels:    map[string]string{"a": "b"},
+					Value:     2,
+					Timestamp: 1395066363500,
+				},
+			},
+		},
+		{
+			name: "exemplars",
+			input: `# TYPE foo histogram
+foo_bucket{le="0.01"} 0
+foo_bucket{le="0.1"} 8 # {} 0.054
+foo_bucket{le="+Inf"} 17 1520879607.789 # {trace_id="KOO5S4vxi0o"} 0.67 1520879602.029
+# EOF
+ignored_after_eof 1
+`,
+			want: []Sample{
+				{
+					Name:   "foo_bucket",
+					Family: "foo",
+					Type:   Histogram,
+					Labels: map[string]string{"le": "0.01"},
+					Value:  0,
+				},
+				{
+					Name:   "foo_bucket",
+					Family: "foo",
+					Type:   Histogram,
+					Labels: map[string]string{"le": "0.1"},
+					Value:  8,
+				},
+				{
+					Name:      "foo_bucket",
+					Family:    "foo",
+					Type:      Histogram,
+					Labels:    map[string]string{"le": "+Inf"},
+					Value:     17,
+					Timestamp: 1520879607789,
+				},
+			},
+		},
+		{
+			name: "special values",
+			input: `positive_infinity +Inf
+negative_infinity -Inf
+`,
+			want: []Sample{
+				{
+					Name:   "positive_infinity",
+					Family: "positive_infinity",
+					Type:   Untyped,
+					Labels: map[string]string{},
+					Value:  math.Inf(1),
+				},
+				{
+					Name:   "negative_infinity",
+					Family: "negative_infinity",
+					Type:   Untyped,
+					Labels: map[string]string{},
+					Value:  math.Inf(-1),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNaN(t *testing.T) {
+	got, err := Parse(strings.NewReader("not_a_number NaN\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(got) != 1 || !math.IsNaN(got[0].Value) {
+		t.Errorf("Parse() = %+v, want one NaN sample", got)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{
+			name:  "missing value",
+			input: "request_total{direction=\"inbound\"}\n",
+			err:   "line 1: invalid value and timestamp",
+		},
+		{
+			name:  "unterminated label value",
+			input: "# TYPE request_total counter\nrequest_total{direction=\"inbound} 1\n",
+			err:   "line 2: unterminated value of label direction",
+		},
+		{
+			name:  "unquoted label value",
+			input: "request_total{direction=inbound} 1\n",
+			err:   "line 1: label direction value is not quoted",
+		},
+		{
+			name:  "invalid value",
+			input: "request_total one\n",
+			err:   "line 1: strconv.ParseFloat",
+		},
+		{
+			name:  "invalid timestamp",
+			input: "request_total 1 yesterday\n",
+			err:   "line 1: invalid timestamp",
+		},
+		{
+			name:  "too many fields",
+			input: "request_total 1 2 3\n",
+			err:   "line 1: invalid value and timestamp",
+		},
+		{
+			name:  "no name",
+			input: "{direction=\"inbound\"} 1\n",
+			err:   "line 1: invalid sample",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
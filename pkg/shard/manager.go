@@ -0,0 +1,418 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	name2 "github.com/rancher/wrangler/pkg/name"
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+const (
+	leaseLabel = "autoscale.rio.cattle.io/lease"
+	shardLabel = "autoscale.rio.cattle.io/shard"
+
+	memberLease = "member"
+	shardLease  = "shard"
+)
+
+var (
+	// LeaseDuration is how long a shard or member lease is valid without being renewed
+	LeaseDuration = 15 * time.Second
+	// RenewInterval is how often leases are renewed and shards are rebalanced
+	RenewInterval = 5 * time.Second
+)
+
+// Manager splits autoscaled services across replicas. Every service belongs to one of a fixed number of shards by a
+// consistent hash of its namespace/name key, and every shard is held by one replica through a Lease. Each replica also
+// holds a member Lease, so replicas know how many of them are alive and hold at most their fair share of the shards.
+// When a replica joins the others release the shards above their share. A replica that stops deletes its member lease,
+// one that dies leaves leases that expire, its shards are taken over and its member lease is deleted by the others
+type Manager struct {
+	leases   coordinationclient.LeaseInterface
+	name     string
+	identity string
+	shards   int
+
+	lock      sync.RWMutex
+	owned     map[int]time.Time
+	holders   map[int]string
+	callbacks []func()
+	releases  []func(released func(key string) bool)
+	done      chan struct{}
+}
+
+// NewManager returns a Manager of shards shards with leases called name in namespace
+func NewManager(k8s kubernetes.Interface, namespace, name string, shards int) (*Manager, error) {
+	if namespace == "" {
+		namespace = "kube-system"
+	}
+	if shards <= 0 {
+		return nil, fmt.Errorf("number of shards %d must be positive", shards)
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return newManager(k8s.CoordinationV1().Leases(namespace), name, identity, shards), nil
+}
+
+func newManager(leases coordinationclient.LeaseInterface, name, identity string, shards int) *Manager {
+	return &Manager{
+		leases:   leases,
+		name:     name,
+		identity: identity,
+		shards:   shards,
+		owned:    map[int]time.Time{},
+		holders:  map[int]string{},
+		done:     make(chan struct{}),
+	}
+}
+
+// Shard returns the shard of key out of shards using jump consistent hashing, so changing the number of shards moves as
+// few keys as possible
+func Shard(key string, shards int) int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	k := h.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < int64(shards) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
+
+// Owns returns true if this replica holds the shard of the service key
+func (m *Manager) Owns(key string) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	_, ok := m.owned[Shard(key, m.shards)]
+	return ok
+}
+
+// Owner returns the identity of the replica holding the shard of the service key, "" if no replica does
+func (m *Manager) Owner(key string) string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.holders[Shard(key, m.shards)]
+}
+
+// OnChange registers f to be called whenever the shards held by this replica change
+func (m *Manager) OnChange(f func()) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.callbacks = append(m.callbacks, f)
+}
+
+// OnRelease registers f to be called before this replica releases a shard, with a func returning true for the service
+// keys of that shard. The lease is only released once f returns, so f can save state for the next owner
+func (m *Manager) OnRelease(f func(released func(key string) bool)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.releases = append(m.releases, f)
+}
+
+// Done returns a channel closed once Run returned, after the shards of this replica are released
+func (m *Manager) Done() <-chan struct{} {
+	return m.done
+}
+
+// Run holds the shards of this replica until ctx is done, then releases them and deletes the member lease
+func (m *Manager) Run(ctx context.Context) {
+	defer close(m.done)
+	ticker := time.NewTicker(RenewInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.sync(time.Now()); err != nil {
+			logrus.Warnf("Failed to sync autoscaler shards: %v", err)
+			m.expire(time.Now())
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			m.releaseAll()
+			return
+		}
+	}
+}
+
+func (m *Manager) sync(now time.Time) error {
+	if err := m.renewMember(now); err != nil {
+		return err
+	}
+
+	leases, err := m.leases.List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s in (%s,%s)", leaseLabel, memberLease, shardLease),
+	})
+	if err != nil {
+		return err
+	}
+
+	members := 0
+	shards := map[int]*coordinationv1.Lease{}
+	holders := map[int]string{}
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		switch lease.Labels[leaseLabel] {
+		case memberLease:
+			if live(lease, now) {
+				members++
+			} else if !live(lease, now.Add(-LeaseDuration)) && lease.Name != m.memberName() {
+				m.collect(lease)
+			}
+		case shardLease:
+			shard, err := strconv.Atoi(lease.Labels[shardLabel])
+			if err != nil || shard < 0 || shard >= m.shards {
+				continue
+			}
+			shards[shard] = lease
+			if live(lease, now) {
+				holders[shard] = *lease.Spec.HolderIdentity
+			}
+		}
+	}
+	if members == 0 {
+		members = 1
+	}
+	share := (m.shards + members - 1) / members
+
+	owned := map[int]time.Time{}
+	for _, shard := range sortedShards(shards) {
+		if holders[shard] != m.identity {
+			continue
+		}
+		if len(owned) >= share {
+			logrus.Infof("releasing autoscaler shard %d, %d replicas share %d shards", shard, members, m.shards)
+			if err := m.release(shards[shard], shard, now); err != nil {
+				logrus.Warnf("Failed to release autoscaler shard %d: %v", shard, err)
+			}
+			delete(holders, shard)
+			continue
+		}
+		if err := m.update(shards[shard], m.identity, now); err != nil {
+			logrus.Warnf("Failed to renew autoscaler shard %d: %v", shard, err)
+			delete(holders, shard)
+			continue
+		}
+		owned[shard] = now
+	}
+
+	for shard := 0; shard < m.shards && len(owned) < share; shard++ {
+		if holders[shard] != "" {
+			continue
+		}
+		var err error
+		if lease, ok := shards[shard]; ok {
+			err = m.update(lease, m.identity, now)
+		} else {
+			err = m.create(shard, now)
+		}
+		if err != nil {
+			logrus.Debugf("Failed to acquire autoscaler shard %d: %v", shard, err)
+			continue
+		}
+		logrus.Infof("acquired autoscaler shard %d", shard)
+		holders[shard] = m.identity
+		owned[shard] = now
+	}
+
+	m.set(owned, holders)
+	return nil
+}
+
+// expire drops the shards whose leases ran out because they could not be renewed
+func (m *Manager) expire(now time.Time) {
+	m.lock.RLock()
+	owned := map[int]time.Time{}
+	holders := map[int]string{}
+	for shard, renewed := range m.owned {
+		if now.Sub(renewed) < LeaseDuration {
+			owned[shard] = renewed
+		}
+	}
+	for shard, holder := range m.holders {
+		holders[shard] = holder
+	}
+	m.lock.RUnlock()
+	m.set(owned, holders)
+}
+
+func (m *Manager) set(owned map[int]time.Time, holders map[int]string) {
+	m.lock.Lock()
+	changed := len(owned) != len(m.owned)
+	for shard := range owned {
+		if _, ok := m.owned[shard]; !ok {
+			changed = true
+		}
+	}
+	m.owned = owned
+	m.holders = holders
+	callbacks := m.callbacks
+	m.lock.Unlock()
+
+	if changed {
+		for _, f := range callbacks {
+			f()
+		}
+	}
+}
+
+func (m *Manager) releaseAll() {
+	now := time.Now()
+	for shard := range m.ownedShards() {
+		lease, err := m.leases.Get(m.shardName(shard), metav1.GetOptions{})
+		if err == nil && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == m.identity {
+			err = m.release(lease, shard, now)
+		}
+		if err != nil {
+			logrus.Warnf("Failed to release autoscaler shard %d: %v", shard, err)
+		}
+	}
+	if err := m.leases.Delete(m.memberName(), &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		logrus.Warnf("Failed to delete autoscaler member lease: %v", err)
+	}
+}
+
+// release clears the holder of the lease of shard. The shard is no longer owned and the release callbacks have returned
+// before, so services of the shard are neither autoscaled here nor missing their saved state once another replica
+// acquires it
+func (m *Manager) release(lease *coordinationv1.Lease, shard int, now time.Time) error {
+	m.lock.Lock()
+	delete(m.owned, shard)
+	releases := m.releases
+	m.lock.Unlock()
+
+	for _, f := range releases {
+		f(func(key string) bool {
+			return Shard(key, m.shards) == shard
+		})
+	}
+	return m.update(lease, "", now)
+}
+
+// collect deletes the member lease of a replica that stopped renewing it without deleting it. The lease is only deleted
+// as it was listed, so a replica that renewed it in the meantime keeps it
+func (m *Manager) collect(lease *coordinationv1.Lease) {
+	logrus.Infof("deleting expired autoscaler member lease %s", lease.Name)
+	err := m.leases.Delete(lease.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{
+			UID:             &lease.UID,
+			ResourceVersion: &lease.ResourceVersion,
+		},
+	})
+	if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+		logrus.Warnf("Failed to delete expired autoscaler member lease %s: %v", lease.Name, err)
+	}
+}
+
+func (m *Manager) ownedShards() map[int]time.Time {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	result := map[int]time.Time{}
+	for shard, renewed := range m.owned {
+		result[shard] = renewed
+	}
+	return result
+}
+
+func (m *Manager) renewMember(now time.Time) error {
+	lease, err := m.leases.Get(m.memberName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = m.leases.Create(m.newLease(m.memberName(), memberLease, "", now))
+		return err
+	} else if err != nil {
+		return err
+	}
+	return m.update(lease, m.identity, now)
+}
+
+func (m *Manager) create(shard int, now time.Time) error {
+	_, err := m.leases.Create(m.newLease(m.shardName(shard), shardLease, strconv.Itoa(shard), now))
+	return err
+}
+
+// update sets the holder of lease, the resource version of lease makes it fail if another replica changed it since
+func (m *Manager) update(lease *coordinationv1.Lease, holder string, now time.Time) error {
+	lease = lease.DeepCopy()
+	if current := lease.Spec.HolderIdentity; holder != "" && (current == nil || *current != holder) {
+		lease.Spec.AcquireTime = &metav1.MicroTime{Time: now}
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions += *lease.Spec.LeaseTransitions
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.RenewTime = &metav1.MicroTime{Time: now}
+	lease.Spec.LeaseDurationSeconds = leaseDurationSeconds()
+	_, err := m.leases.Update(lease)
+	return err
+}
+
+func (m *Manager) newLease(name, kind, shard string, now time.Time) *coordinationv1.Lease {
+	labels := map[string]string{
+		leaseLabel: kind,
+	}
+	if shard != "" {
+		labels[shardLabel] = shard
+	}
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &m.identity,
+			LeaseDurationSeconds: leaseDurationSeconds(),
+			AcquireTime:          &metav1.MicroTime{Time: now},
+			RenewTime:            &metav1.MicroTime{Time: now},
+		},
+	}
+}
+
+func (m *Manager) shardName(shard int) string {
+	return fmt.Sprintf("%s-shard-%d", m.name, shard)
+}
+
+func (m *Manager) memberName() string {
+	return name2.SafeConcatName(m.name, "member", m.identity)
+}
+
+func live(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || lease.Spec.RenewTime == nil {
+		return false
+	}
+	duration := LeaseDuration
+	if lease.Spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	return now.Before(lease.Spec.RenewTime.Add(duration))
+}
+
+func leaseDurationSeconds() *int32 {
+	seconds := int32(LeaseDuration / time.Second)
+	return &seconds
+}
+
+func sortedShards(shards map[int]*coordinationv1.Lease) []int {
+	var result []int
+	for shard := range shards {
+		result = append(result, shard)
+	}
+	sort.Ints(result)
+	return result
+}
@@ -0,0 +1,319 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// fakeLeases keeps leases in memory and fails updates and deletes of stale resource versions like the API server
+type fakeLeases struct {
+	coordinationclient.LeaseInterface
+
+	lock    sync.Mutex
+	version int
+	leases  map[string]*coordinationv1.Lease
+}
+
+func newFakeLeases() *fakeLeases {
+	return &fakeLeases{
+		leases: map[string]*coordinationv1.Lease{},
+	}
+}
+
+func (f *fakeLeases) Create(lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.leases[lease.Name]; ok {
+		return nil, errors.NewAlreadyExists(coordinationv1.Resource("leases"), lease.Name)
+	}
+	return f.store(lease), nil
+}
+
+func (f *fakeLeases) Update(lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	existing, ok := f.leases[lease.Name]
+	if !ok {
+		return nil, errors.NewNotFound(coordinationv1.Resource("leases"), lease.Name)
+	}
+	if existing.ResourceVersion != lease.ResourceVersion {
+		return nil, errors.NewConflict(coordinationv1.Resource("leases"), lease.Name, fmt.Errorf("stale resource version"))
+	}
+	return f.store(lease), nil
+}
+
+func (f *fakeLeases) Delete(name string, options *metav1.DeleteOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	existing, ok := f.leases[name]
+	if !ok {
+		return errors.NewNotFound(coordinationv1.Resource("leases"), name)
+	}
+	if p := options.Preconditions; p != nil && p.ResourceVersion != nil && *p.ResourceVersion != existing.ResourceVersion {
+		return errors.NewConflict(coordinationv1.Resource("leases"), name, fmt.Errorf("stale resource version"))
+	}
+	delete(f.leases, name)
+	return nil
+}
+
+func (f *fakeLeases) Get(name string, _ metav1.GetOptions) (*coordinationv1.Lease, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	lease, ok := f.leases[name]
+	if !ok {
+		return nil, errors.NewNotFound(coordinationv1.Resource("leases"), name)
+	}
+	return lease.DeepCopy(), nil
+}
+
+func (f *fakeLeases) List(opts metav1.ListOptions) (*coordinationv1.LeaseList, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	list := &coordinationv1.LeaseList{}
+	for _, lease := range f.leases {
+		if selector.Matches(labels.Set(lease.Labels)) {
+			list.Items = append(list.Items, *lease.DeepCopy())
+		}
+	}
+	return list, nil
+}
+
+// store saves a copy of lease with a new resource version, the caller must hold the lock
+func (f *fakeLeases) store(lease *coordinationv1.Lease) *coordinationv1.Lease {
+	f.version++
+	lease = lease.DeepCopy()
+	lease.ResourceVersion = strconv.Itoa(f.version)
+	f.leases[lease.Name] = lease
+	return lease.DeepCopy()
+}
+
+func (f *fakeLeases) holder(name string) string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if lease, ok := f.leases[name]; ok && lease.Spec.HolderIdentity != nil {
+		return *lease.Spec.HolderIdentity
+	}
+	return ""
+}
+
+// ownedShards returns the shards m holds, sorted
+func ownedShards(m *Manager) []int {
+	var result []int
+	for shard := 0; shard < m.shards; shard++ {
+		if _, ok := m.ownedShards()[shard]; ok {
+			result = append(result, shard)
+		}
+	}
+	return result
+}
+
+func TestShard(t *testing.T) {
+	tests := []struct {
+		key    string
+		shards int
+		want   int
+	}{
+		{key: "default/hello", shards: 1, want: 0},
+		{key: "default/hello", shards: 4, want: 1},
+		{key: "default/hello", shards: 16, want: 1},
+		{key: "default/hello", shards: 100, want: 88},
+		{key: "default/world", shards: 4, want: 0},
+		{key: "default/world", shards: 100, want: 56},
+		{key: "team-a/api", shards: 16, want: 12},
+		{key: "team-a/api", shards: 100, want: 87},
+	}
+	for _, tt := range tests {
+		if got := Shard(tt.key, tt.shards); got != tt.want {
+			t.Errorf("Shard(%q, %d) = %d, want %d", tt.key, tt.shards, got, tt.want)
+		}
+	}
+}
+
+// TestShardMoves checks that adding a shard only moves keys to the new shard
+func TestShardMoves(t *testing.T) {
+	for shards := 1; shards < 32; shards++ {
+		moved := 0
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("namespace-%d/service-%d", i%7, i)
+			before, after := Shard(key, shards), Shard(key, shards+1)
+			if after < 0 || after > shards {
+				t.Fatalf("Shard(%q, %d) = %d, out of range", key, shards+1, after)
+			}
+			if after != before {
+				if after != shards {
+					t.Fatalf("Shard(%q) moved from %d to %d going to %d shards, want only moves to the new shard", key, before, after, shards+1)
+				}
+				moved++
+			}
+		}
+		// about 1000/(shards+1) keys move to the new shard
+		if want := 1000 / (shards + 1); moved < want/2 || moved > want*2 {
+			t.Errorf("%d keys moved going to %d shards, want about %d", moved, shards+1, want)
+		}
+	}
+}
+
+func TestSyncShare(t *testing.T) {
+	leases := newFakeLeases()
+	a := newManager(leases, "test", "a", 4)
+	b := newManager(leases, "test", "b", 4)
+	now := time.Now()
+
+	if err := a.sync(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := ownedShards(a); fmt.Sprint(got) != "[0 1 2 3]" {
+		t.Fatalf("alone a owns %v, want all shards", got)
+	}
+
+	// b joins while a holds every shard, so there is nothing for b to acquire yet
+	now = now.Add(RenewInterval)
+	if err := b.sync(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := ownedShards(b); len(got) != 0 {
+		t.Fatalf("b owns %v before a released any shard, want none", got)
+	}
+
+	// a releases the shards above its share of two, handing off their services first
+	var released []int
+	a.OnRelease(func(isReleased func(key string) bool) {
+		for shard := 0; shard < a.shards; shard++ {
+			key := keyOf(shard, a.shards)
+			if !isReleased(key) {
+				continue
+			}
+			released = append(released, shard)
+			if a.Owns(key) {
+				t.Errorf("a owns shard %d while releasing it", shard)
+			}
+			if holder := leases.holder(a.shardName(shard)); holder != "a" {
+				t.Errorf("lease of shard %d is held by %q while a releases it, want a", shard, holder)
+			}
+		}
+	})
+	now = now.Add(RenewInterval)
+	if err := a.sync(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := ownedShards(a); fmt.Sprint(got) != "[0 1]" {
+		t.Errorf("a owns %v after b joined, want [0 1]", got)
+	}
+	if fmt.Sprint(released) != "[2 3]" {
+		t.Errorf("a released %v, want [2 3]", released)
+	}
+	for _, shard := range []int{2, 3} {
+		if holder := leases.holder(a.shardName(shard)); holder != "" {
+			t.Errorf("lease of shard %d is held by %q after release, want none", shard, holder)
+		}
+	}
+
+	now = now.Add(RenewInterval)
+	if err := b.sync(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := ownedShards(b); fmt.Sprint(got) != "[2 3]" {
+		t.Errorf("b owns %v, want [2 3]", got)
+	}
+	if owner := a.Owner(keyOf(0, 4)); owner != "a" {
+		t.Errorf("Owner() of shard 0 = %q, want a", owner)
+	}
+}
+
+func TestSyncTakesOverExpired(t *testing.T) {
+	leases := newFakeLeases()
+	a := newManager(leases, "test", "a", 2)
+	b := newManager(leases, "test", "b", 2)
+	now := time.Now()
+
+	if err := a.sync(now); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.sync(now); err != nil {
+		t.Fatal(err)
+	}
+
+	// a dies without releasing anything, once its leases expire b takes over every shard
+	now = now.Add(LeaseDuration + time.Second)
+	if err := b.sync(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := ownedShards(b); fmt.Sprint(got) != "[0 1]" {
+		t.Errorf("b owns %v after a expired, want all shards", got)
+	}
+	if _, err := leases.Get(a.memberName(), metav1.GetOptions{}); err != nil {
+		t.Errorf("member lease of a was deleted as soon as it expired, error = %v", err)
+	}
+
+	// the member lease of a is deleted once it stayed expired for another lease duration
+	now = now.Add(LeaseDuration)
+	if err := b.sync(now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leases.Get(a.memberName(), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("member lease of a still exists, error = %v", err)
+	}
+	if _, err := leases.Get(b.memberName(), metav1.GetOptions{}); err != nil {
+		t.Errorf("member lease of b was deleted, error = %v", err)
+	}
+}
+
+func TestRunReleasesOnStop(t *testing.T) {
+	leases := newFakeLeases()
+	m := newManager(leases, "test", "a", 2)
+	var released int
+	m.OnRelease(func(func(key string) bool) {
+		released++
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go m.Run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ownedShards(m)) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("shards were not acquired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-m.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	if released != 2 {
+		t.Errorf("release callbacks ran %d times, want once per shard", released)
+	}
+	for shard := 0; shard < 2; shard++ {
+		if holder := leases.holder(m.shardName(shard)); holder != "" {
+			t.Errorf("lease of shard %d is held by %q after stopping, want none", shard, holder)
+		}
+	}
+	if _, err := leases.Get(m.memberName(), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("member lease still exists after stopping, error = %v", err)
+	}
+}
+
+// keyOf returns a service key in shard out of shards
+func keyOf(shard, shards int) string {
+	for i := 0; ; i++ {
+		if key := fmt.Sprintf("default/service-%d", i); Shard(key, shards) == shard {
+			return key
+		}
+	}
+}
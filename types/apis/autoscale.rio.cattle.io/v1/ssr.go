@@ -0,0 +1,46 @@
+package v1
+
+import (
+	"github.com/rancher/wrangler/pkg/genericcondition"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ServiceScaleRecommendation is the scale the autoscaler recommends for a rio service. It has the same namespace and name as the service it belongs to
+type ServiceScaleRecommendation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServiceScaleRecommendationSpec   `json:"spec,omitempty"`
+	Status ServiceScaleRecommendationStatus `json:"status,omitempty"`
+}
+
+type ServiceScaleRecommendationSpec struct {
+	// ServiceName is the name of the rio service being autoscaled
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// MinScale is the lower bound of the recommended scale
+	MinScale *int32 `json:"minScale,omitempty"`
+
+	// MaxScale is the upper bound of the recommended scale
+	MaxScale *int32 `json:"maxScale,omitempty"`
+
+	// Concurrency is the target number of in-flight requests per pod
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// Selector selects the pods whose metrics are used to compute the recommendation
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+type ServiceScaleRecommendationStatus struct {
+	// DesiredScale is the number of replicas the service should be scaled to
+	DesiredScale *int32 `json:"desiredScale,omitempty"`
+
+	// ScrapeFailures is the total number of times the metrics of a pod of the service could not be scraped
+	ScrapeFailures int64 `json:"scrapeFailures,omitempty"`
+
+	// Represents the latest available observations of a ServiceScaleRecommendation's current state.
+	Conditions []genericcondition.GenericCondition `json:"conditions,omitempty"`
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rancher/wrangler/pkg/cleanup"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	if err := cleanup.Cleanup("./types/apis"); err != nil {
+		logrus.Fatal(err)
+	}
+	if err := os.RemoveAll("./pkg/generated"); err != nil {
+		logrus.Fatal(err)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	autoscalev1 "github.com/rancher/rio-autoscaler/types/apis/autoscale.rio.cattle.io/v1"
+	controllergen "github.com/rancher/wrangler/pkg/controller-gen"
+	"github.com/rancher/wrangler/pkg/controller-gen/args"
+)
+
+func main() {
+	controllergen.Run(args.Options{
+		OutputPackage: "github.com/rancher/rio-autoscaler/pkg/generated",
+		Boilerplate:   "scripts/boilerplate.go.txt",
+		Groups: map[string]args.Group{
+			"autoscale.rio.cattle.io": {
+				Types: []interface{}{
+					autoscalev1.ServiceScaleRecommendation{},
+				},
+				GenerateTypes: true,
+			},
+		},
+	})
+}
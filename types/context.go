@@ -3,6 +3,8 @@ package types
 import (
 	"context"
 
+	"github.com/rancher/rio-autoscaler/pkg/generated/controllers/autoscale.rio.cattle.io"
+	"github.com/rancher/rio/pkg/generated/controllers/admin.rio.cattle.io"
 	"github.com/rancher/rio/pkg/generated/controllers/rio.cattle.io"
 	core "github.com/rancher/wrangler-api/pkg/generated/controllers/core"
 	"github.com/rancher/wrangler/pkg/apply"
@@ -16,9 +18,11 @@ type contextKey struct{}
 type Context struct {
 	Namespace string
 
-	Core *core.Factory
-	Rio  *rio.Factory
-	K8s  kubernetes.Interface
+	Admin     *admin.Factory
+	Autoscale *autoscale.Factory
+	Core      *core.Factory
+	Rio       *rio.Factory
+	K8s       kubernetes.Interface
 
 	Apply apply.Apply
 }
@@ -34,6 +38,8 @@ func From(ctx context.Context) *Context {
 func NewContext(namespace string, config *rest.Config) *Context {
 	context := &Context{
 		Namespace: namespace,
+		Admin:     admin.NewFactoryFromConfigOrDie(config),
+		Autoscale: autoscale.NewFactoryFromConfigOrDie(config),
 		Core:      core.NewFactoryFromConfigOrDie(config),
 		Rio:       rio.NewFactoryFromConfigOrDie(config),
 		K8s:       kubernetes.NewForConfigOrDie(config),
@@ -45,6 +51,8 @@ func NewContext(namespace string, config *rest.Config) *Context {
 
 func (c *Context) Start(ctx context.Context) error {
 	return start.All(ctx, 5,
+		c.Admin,
+		c.Autoscale,
 		c.Rio,
 		c.Core,
 	)
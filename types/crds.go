@@ -0,0 +1,26 @@
+package types
+
+import (
+	"context"
+
+	"github.com/rancher/wrangler/pkg/crd"
+	"k8s.io/client-go/rest"
+)
+
+func crds() []crd.CRD {
+	return []crd.CRD{
+		crd.NamespacedType("ServiceScaleRecommendation.autoscale.rio.cattle.io/v1").
+			WithStatus(),
+	}
+}
+
+func Types(ctx context.Context, config *rest.Config) error {
+	factory, err := crd.NewFactoryFromClient(config)
+	if err != nil {
+		return err
+	}
+
+	factory.BatchCreateCRDs(ctx, crds()...)
+
+	return factory.BatchWait()
+}